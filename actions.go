@@ -0,0 +1,88 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var channelActionType = reflect.TypeOf(ChannelActionCallback(nil))
+
+// Resolve the actions of Actions and the methods of Receiver.
+func (cd *ChannelDescription) resolveRoutes() {
+	if cd.Actions == nil && cd.Receiver == nil {
+		return
+	}
+
+	cd.routes = map[string]ChannelActionCallback{}
+
+	if cd.Receiver != nil {
+		v := reflect.ValueOf(cd.Receiver)
+		t := v.Type()
+
+		for i := 0; i < t.NumMethod(); i++ {
+			m := v.Method(i)
+
+			if !m.Type().ConvertibleTo(channelActionType) {
+				continue
+			}
+
+			cd.routes[snakeCase(t.Method(i).Name)] = m.Convert(channelActionType).Interface().(ChannelActionCallback)
+		}
+	}
+
+	for action, handler := range cd.Actions {
+		cd.routes[action] = handler
+	}
+}
+
+// Route the client action to its handler, with the `action` key stripped from the payload.
+func (c *Channel) dispatchAction(data string) {
+	payload := map[string]json.RawMessage{}
+
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		logger.Error(fmt.Sprintf("Unable to process %s: malformed data %s", c.Name, data))
+
+		return
+	}
+
+	var action string
+	json.Unmarshal(payload["action"], &action)
+	delete(payload, "action")
+
+	args, _ := json.Marshal(payload)
+
+	if handler, ok := c.descrption.routes[action]; ok {
+		handler(c, args)
+
+		return
+	}
+
+	logger.Error(fmt.Sprintf("Unable to process %s#%s(%s)", c.Name, action, args))
+
+	if c.descrption.UnknownAction != nil {
+		c.descrption.UnknownAction(c, action, args)
+	}
+}
+
+// E.g. SendMessage -> send_message, HTTPRequest -> http_request
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+
+			r = unicode.ToLower(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
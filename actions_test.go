@@ -0,0 +1,92 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type testRoomActions struct {
+	messages []string
+}
+
+func (r *testRoomActions) SendMessage(c *Channel, data json.RawMessage) {
+	d := struct {
+		Message string `json:"message"`
+	}{}
+
+	json.Unmarshal(data, &d)
+	r.messages = append(r.messages, d.Message)
+}
+
+func (r *testRoomActions) Typing(c *Channel, data json.RawMessage) {
+	r.messages = append(r.messages, "typing (receiver)")
+}
+
+// Not an action.
+func (r *testRoomActions) String() string {
+	return "room actions"
+}
+
+func TestActionRouting(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	cable := conn.cable
+	receiver := &testRoomActions{}
+	unknown := []string{}
+	performed := 0
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:     "RoomChannel",
+		Receiver: receiver,
+		Actions: map[string]ChannelActionCallback{
+			"typing": func(c *Channel, data json.RawMessage) {
+				receiver.messages = append(receiver.messages, "typing "+string(data))
+			},
+		},
+		UnknownAction: func(c *Channel, action string, data json.RawMessage) {
+			unknown = append(unknown, action+" "+string(data))
+		},
+		PerformAction: func(c *Channel, data string) {
+			performed++
+		},
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+
+	for _, data := range []string{
+		`{\"action\":\"send_message\",\"message\":\"hello\"}`,
+		`{\"action\":\"typing\",\"at\":1}`,
+		`{\"action\":\"string\"}`,
+		`{\"action\":\"dance\",\"speed\":2}`,
+		`not json`,
+	} {
+		ws.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"` + data + `"}`))
+	}
+
+	if len(receiver.messages) != 2 || receiver.messages[0] != "hello" || receiver.messages[1] != `typing {"at":1}` {
+		t.Errorf("Unexpected actions: %v", receiver.messages)
+	}
+
+	if len(unknown) != 2 || unknown[0] != "string {}" || unknown[1] != `dance {"speed":2}` {
+		t.Errorf("Unexpected unknown actions: %v", unknown)
+	}
+
+	if performed != 0 {
+		t.Error("PerformAction is called with the actions routed.")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Speak":       "speak",
+		"SendMessage": "send_message",
+		"HTTPRequest": "http_request",
+		"GetURL":      "get_url",
+	} {
+		if s := snakeCase(name); s != expected {
+			t.Errorf("snakeCase(%s) = %s, expected %s", name, s, expected)
+		}
+	}
+}
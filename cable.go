@@ -1,11 +1,15 @@
 package actioncable
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,24 +18,55 @@ const (
 	Version = "0.1.1"
 )
 
+var ErrWhisperUnsupported = errors.New("actioncable: whispers are not supported by the pubsub")
+
 type Cable struct {
-	Config              *config
-	PubSub              PubSub
-	connections         map[*Connection]struct{}
+	Config *config
+	PubSub PubSub
+	// The connections on this node.
+	Connections         *ConnectionRegistry
 	channelDescriptions map[string]*ChannelDescription
+	poller              *longPoller
+	pollerOnce          sync.Once
+	presence            *presenceTracker
+	presenceOnce        sync.Once
+	quotas              *quotaTracker
+	quotaOnce           sync.Once
+	stopOnce            sync.Once
 }
 
 var logger Logger
 
 func NewActionCable(cfg *config) *Cable {
+	// The Redis of WithRedisHistory, WithRedisPresence and WithRedisQuotas.
+	if h, ok := cfg.history.(*RedisHistory); ok && h.Client == nil {
+		h.Client = cfg.redisClient("WithRedisHistory")
+	}
+
+	if p, ok := cfg.presence.(*RedisPresence); ok && p.Client == nil {
+		p.Client = cfg.redisClient("WithRedisPresence")
+	}
+
+	if q, ok := cfg.quotas.Store.(*RedisConnectionQuota); ok && q.Client == nil {
+		q.Client = cfg.redisClient("WithRedisQuotas")
+	}
+
 	cb := &Cable{
 		Config:              cfg,
 		PubSub:              cfg.pubsub,
-		connections:         map[*Connection]struct{}{},
+		Connections:         newConnectionRegistry(),
 		channelDescriptions: map[string]*ChannelDescription{},
 	}
 	logger = cfg.logger
 
+	if cfg.sessionWindow > 0 && cfg.sessions == nil {
+		if r, ok := cfg.pubsub.(*RedisPubSub); ok {
+			cfg.sessions = &RedisSessionStore{Client: r.Client}
+		} else {
+			cfg.sessions = NewMemorySessionStore()
+		}
+	}
+
 	if err := cb.PubSub.Run(); err != nil {
 		panic(err)
 	}
@@ -42,9 +77,18 @@ func NewActionCable(cfg *config) *Cable {
 func (cb *Cable) Handle(w http.ResponseWriter, r *http.Request) error {
 	cfg := cb.Config
 
+	protocol := cfg.negotiateProtocol(websocket.Subprotocols(r))
+
+	if protocol == nil {
+		logger.Info(fmt.Sprintf("Rejected a connection offering unsupported subprotocols: %v.", websocket.Subprotocols(r)))
+		rejectUnsupportedProtocol(w)
+
+		return ErrUnsupportedProtocol
+	}
+
 	upgrader := &websocket.Upgrader{
 		CheckOrigin:       checkOrigin(cfg.allowedOrigins),
-		Subprotocols:      []string{"actioncable-v1-json"},
+		Subprotocols:      []string{protocol.name},
 		EnableCompression: cfg.enableCompression,
 		ReadBufferSize:    cfg.readBufferSize,
 		WriteBufferSize:   cfg.writeBufferSize,
@@ -69,22 +113,55 @@ func (cb *Cable) Handle(w http.ResponseWriter, r *http.Request) error {
 	id, pass := cfg.authenticator(r)
 
 	if !pass {
-		return rejectUnauthorizedConnection(wsConn)
+		return cb.rejectUnauthorizedConnection(wsConn, protocol)
 	}
 
+	_, err = cb.connect(id, wsConn, protocol, cb.takeSession(r.URL.Query().Get("restore_token"), id))
+
+	return err
+}
+
+// Set up a connection of the authenticated client over the transport, restoring the session if any.
+// The connections exceeding the quotas are closed with ErrQuotaExceeded.
+func (cb *Cable) connect(id any, transport IConn, p *protocol, session *Session) (*Connection, error) {
 	conn := &Connection{
-		identifier: id,
-		wsConn:     wsConn,
-		cable:      cb,
-		send:       make(chan any),
-		done:       make(chan struct{}),
-		channels:   map[string]map[string]*Channel{},
+		identifier:   id,
+		wsConn:       transport,
+		protocol:     p,
+		sid:          randomID(),
+		restoreToken: randomToken(),
+		session:      session,
+		cable:        cb,
+		send:         newSendQueue(cb.Config.sendQueueSize, cb.Config.sendQueuePolicy),
+		done:         make(chan struct{}),
+		channels:     map[string]map[string]*Channel{},
+	}
+
+	if err := cb.acquireConnectionQuota(conn); err != nil {
+		logger.Info(fmt.Sprintf("The connection of %v was rejected: %v", id, err))
+
+		conn.closed = true
+		closeConnection(transport, p.codec, "quota exceeded", false)
+
+		if onDisconnect := cb.Config.onDisconnect; onDisconnect != nil {
+			onDisconnect(conn, DisconnectQuotaExceeded)
+		}
+
+		return nil, err
 	}
 
 	conn.Setup()
-	cb.connections[conn] = struct{}{}
 
-	return nil
+	// Closed meanwhile, OnDisconnect has been called already.
+	if !cb.Connections.add(conn) {
+		return conn, nil
+	}
+
+	if onConnect := cb.Config.onConnect; onConnect != nil {
+		onConnect(conn)
+	}
+
+	return conn, nil
 }
 
 func (cb *Cable) RegisterChannel(cd *ChannelDescription) {
@@ -96,15 +173,35 @@ func (cb *Cable) RegisterChannel(cd *ChannelDescription) {
 		panic(fmt.Sprintf("the Channel %s has already been registered.", cd.Name))
 	}
 
+	for _, t := range cd.Periodically {
+		if t.Every <= 0 || t.Callback == nil {
+			panic(fmt.Sprintf("invalid periodic timer of the Channel %s: %+v", cd.Name, t))
+		}
+	}
+
+	cd.resolveRoutes()
+	cd.defaultCallbacks()
+
 	cb.channelDescriptions[cd.Name] = cd
 }
 
-// Disconnect a remote connection by the connection identifier.
+// Disconnect the remote connections by the connection identifier. For the connections identified by Identifiers,
+// it could be any subset of them, e.g. `Identifiers{"current_account": "1"}` disconnects all the connections of
+// the account.
 func (cb *Cable) DisconnectRemoteConnection(identifier any) {
-	name := fmt.Sprintf("action_cable/%v", identifier)
-	msg, _ := json.Marshal(map[string]string{"type": "disconnect"})
+	cmd := &remoteCommand{Type: "disconnect"}
+	broadcastings := internalBroadcastings(identifier)
+	broadcasting := broadcastings[0]
+
+	// Every connection with the identifiers subscribes to the broadcasting of the first one.
+	if ids, ok := identifier.(Identifiers); ok && len(ids) > 0 {
+		cmd.Identifiers = ids
+		broadcasting = broadcastings[1]
+	}
 
-	cb.PubSub.Broadcast(name, name, msg)
+	msg, _ := json.Marshal(cmd)
+
+	cb.PubSub.Broadcast(internalChannelName, broadcasting, msg)
 }
 
 func (cb *Cable) Broadcast(channel, broadcasting string, message any) error {
@@ -114,14 +211,95 @@ func (cb *Cable) Broadcast(channel, broadcasting string, message any) error {
 		return err
 	}
 
-	return cb.PubSub.Broadcast(channel, broadcasting, msg)
+	return cb.broadcast(channel, broadcasting, msg)
 }
 
-func (cb *Cable) Stop() {
-	cb.PubSub.Stop()
-	for conn := range cb.connections {
-		conn.Close("server is shutdown.")
+// Publish the encoded message, appending it to the stream history first if the history is enabled.
+func (cb *Cable) broadcast(channelName, broadcasting string, message []byte) error {
+	msg := newBroadcastMessage(channelName, broadcasting, message)
+
+	if history := cb.Config.history; history != nil {
+		pos, err := history.Append(historyStream(channelName, broadcasting), message)
+
+		if err != nil {
+			logger.Error(fmt.Sprintf("Append %s to the history failed: %v", broadcasting, err))
+		}
+
+		msg.position = pos
+	}
+
+	return cb.publish(msg)
+}
+
+// Publish the message without appending it to the history, e.g. the whispers and the presence events.
+func (cb *Cable) publish(msg *broadcastMessage) error {
+	if p, ok := cb.PubSub.(messagePublisher); ok {
+		return p.publish(msg)
 	}
+
+	return cb.PubSub.Broadcast(msg.channelName, msg.broadcasting, msg.data)
+}
+
+// Relay a whisper to the subscribers of the broadcasting except the sender. The whispers are ephemeral, they are
+// never kept in the history. The PubSubs other than the built-in ones can't exclude the sender, so they don't
+// support the whispers.
+func (cb *Cable) whisper(channelName, broadcasting string, data []byte, sender string) error {
+	p, ok := cb.PubSub.(messagePublisher)
+
+	if !ok {
+		return ErrWhisperUnsupported
+	}
+
+	msg := newBroadcastMessage(channelName, broadcasting, data)
+	msg.exclude = sender
+
+	return p.publish(msg)
+}
+
+// Stop the cable and close the connections on this node. The calls after the first one do nothing.
+func (cb *Cable) Stop() {
+	cb.stopOnce.Do(func() {
+		if cb.poller != nil {
+			close(cb.poller.stop)
+		}
+
+		if cb.presence != nil {
+			close(cb.presence.stop)
+		}
+
+		if cb.quotas != nil {
+			close(cb.quotas.stop)
+		}
+
+		// The connections are closed first, since saving their sessions, leaving the presences and releasing the
+		// quotas could use the client of the RedisPubSub.
+		for _, conn := range cb.Connections.Select(nil) {
+			conn.close(DisconnectServerShutdown, "server is shutdown.")
+		}
+		cb.PubSub.Stop()
+	})
+}
+
+// A random hex string, e.g. for session IDs and history epochs.
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// A random hex string hard to guess, e.g. for the session restore tokens.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Refuse the handshake the way the WebSocket protocol does for an unacceptable request.
+func rejectUnsupportedProtocol(w http.ResponseWriter) {
+	w.Header().Set("Sec-Websocket-Version", "13")
+	http.Error(w, ErrUnsupportedProtocol.Error(), http.StatusBadRequest)
 }
 
 // Stolen from github.com/anycable/anycable-go
@@ -1,20 +1,12 @@
 package actioncable
 
 func newTestCable() *Cable {
-	cfg := NewConfig().WithLogger(
-		&testLogger{
-			debugMessages: []string{},
-			infoMessages:  []string{},
-			errorMessages: []string{},
-		},
-	)
-
-	logger = cfg.logger
+	cfg := NewConfig()
 
 	return &Cable{
 		Config:              NewConfig(),
 		PubSub:              cfg.pubsub,
-		connections:         map[*Connection]struct{}{},
+		Connections:         newConnectionRegistry(),
 		channelDescriptions: map[string]*ChannelDescription{},
 	}
 }
@@ -4,17 +4,79 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 )
 
 type ChannelSubscribedCallback func(*Channel)
 type ChannelUnsubscribedCallback func(*Channel)
 type ChannelPerformActionCallback func(*Channel, string)
 
+// Handle a client action, the data is the payload of the action without the `action` key.
+type ChannelActionCallback func(c *Channel, data json.RawMessage)
+
+// Handle a client action without handler.
+type ChannelUnknownActionCallback func(c *Channel, action string, data json.RawMessage)
+
+// Handle a message of a stream, see Channel.StreamFromWith.
+type StreamCallback func(c *Channel, message any)
+
+// Decode the messages of a stream for the StreamCallback.
+type StreamCoder interface {
+	Decode(data []byte) (any, error)
+}
+
+// Decode the messages as JSON, every subscriber gets its own copy to modify.
+type JSONStreamCoder struct{}
+
+func (JSONStreamCoder) Decode(data []byte) (any, error) {
+	var v any
+	err := json.Unmarshal(data, &v)
+
+	return v, err
+}
+
+// Pass the messages through as json.RawMessage without decoding.
+type RawStreamCoder struct{}
+
+func (RawStreamCoder) Decode(data []byte) (any, error) {
+	return json.RawMessage(data), nil
+}
+
+type streamHandler struct {
+	callback StreamCallback
+	coder    StreamCoder
+}
+
+func (h streamHandler) handle(c *Channel, msg *broadcastMessage) {
+	message, err := h.coder.Decode(msg.data)
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("Decode message failed: %s, %v", msg.data, err))
+
+		return
+	}
+
+	h.callback(c, message)
+}
+
 type ChannelDescription struct {
-	Name          string
-	Subscribed    ChannelSubscribedCallback
-	Unsubscribed  ChannelUnsubscribedCallback
+	Name         string
+	Subscribed   ChannelSubscribedCallback
+	Unsubscribed ChannelUnsubscribedCallback
+	// Handle the raw data of the client actions. It's not called if Actions or Receiver is set.
 	PerformAction ChannelPerformActionCallback
+	// The handlers of the client actions, keyed by the action names.
+	Actions map[string]ChannelActionCallback
+	// A value whose exported methods of the ChannelActionCallback signature (besides the receiver) become actions,
+	// named in snake case (e.g. SendMessage handles `send_message`), like the methods of Rails channels.
+	// The handlers of Actions take precedence.
+	Receiver any
+	// Called for the actions without handler, when Actions or Receiver is set.
+	UnknownAction ChannelUnknownActionCallback
+	// The tasks run periodically while subscribed, see PeriodicTimer.
+	Periodically []PeriodicTimer
+	// Actions and the methods of Receiver, resolved by RegisterChannel.
+	routes map[string]ChannelActionCallback
 }
 
 // The channel provides the basic structure of grouping behavior into logical units when communicating over the WebSocket connection.
@@ -48,33 +110,149 @@ type Channel struct {
 	isConfirmationSent     bool
 	descrption             *ChannelDescription
 	streams                map[string]struct{}
-	onBroadcast            func(*Channel, []byte)
-	mu                     sync.Mutex
+	// Set once unsubscribed, so the streams subscribed to meanwhile are unsubscribed by themselves.
+	isUnsubscribed bool
+	// The streams with their own callbacks, see StreamFromWith.
+	streamHandlers map[string]streamHandler
+	onBroadcast    func(*Channel, *broadcastMessage)
+	// Live broadcasts are held back while the history is being replayed.
+	replaying bool
+	pending   []*broadcastMessage
+	// The number of the streams being subscribed to by StreamFrom, signaled by streamsSettled when it drops to zero.
+	subscribingStreams int
+	streamsSettled     *sync.Cond
+	// The broadcasting the whispers are relayed to, and the token bucket of the whisper rate limit.
+	whisperTo      string
+	whisperLimiter *tokenBucket
+	// The broadcastings joined the presence of, with the info of the member.
+	presences map[string]json.RawMessage
+	// The subscription of the typed channels, see NewTypedChannel.
+	state any
+	// The timers added by Every before the subscription is confirmed, whether Every is called, and the channel
+	// stopping the running ones.
+	timers        []PeriodicTimer
+	everyCalled   bool
+	timersStarted bool
+	timersStopped bool
+	timersStop    chan struct{}
+	// The streams counted against Quotas.StreamsPerChannel, and whether the Subscribed callback is running.
+	quotaStreams map[string]struct{}
+	subscribing  bool
+	mu           sync.Mutex
 }
 
 // Start streaming from the named broadcasting pubsub queue.
 func (c *Channel) StreamFrom(broadcasting string) {
+	c.StreamFromWith(broadcasting, nil, nil)
+}
+
+// Start streaming from the named broadcasting pubsub queue, handing the messages decoded by the coder to the
+// callback instead of transmitting them, like `stream_from broadcasting, callback, coder:` of Rails. The callback
+// could filter, transform or drop the messages per subscriber, transmitting them by Channel.Transmit.
+// A nil callback transmits the messages as they are, a nil coder is JSONStreamCoder.
+//
+// NOTE: the subscriptions streaming with callbacks are not restored with the sessions, the clients subscribe to them
+// again instead.
+func (c *Channel) StreamFromWith(broadcasting string, callback StreamCallback, coder StreamCoder) {
 	if c.isSubscriptionRejected {
 		return
 	}
 
+	c.mu.Lock()
+	allowed := c.allowStream(broadcasting)
+	subscribing := c.subscribing
+	c.mu.Unlock()
+
+	if !allowed {
+		logger.Info(fmt.Sprintf("%s exceeded the quota of streams by %s", c.Identifier, broadcasting))
+
+		if subscribing {
+			c.Reject()
+		}
+
+		return
+	}
+
+	if callback != nil {
+		if coder == nil {
+			coder = JSONStreamCoder{}
+		}
+
+		c.mu.Lock()
+		if c.streamHandlers == nil {
+			c.streamHandlers = map[string]streamHandler{}
+		}
+		c.streamHandlers[broadcasting] = streamHandler{callback: callback, coder: coder}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.subscribingStreams++
+	c.mu.Unlock()
+
 	go func() {
+		defer c.settleStream()
+
 		if err := c.pubsub.Subscribe(c, broadcasting); err != nil {
 			logger.Error(fmt.Sprintf("Subscribe %s failed due to: %s", broadcasting, err.Error()))
 
+			c.mu.Lock()
+			delete(c.streamHandlers, broadcasting)
+			delete(c.quotaStreams, broadcasting)
+			c.mu.Unlock()
+
 			return
 		}
 
-		logger.Debug(fmt.Sprintf("%s is streaming from %s", c.Name, broadcasting))
-
 		c.mu.Lock()
-		c.streams[broadcasting] = struct{}{}
+		rejected := c.isSubscriptionRejected || c.isUnsubscribed
+		if !rejected {
+			c.streams[broadcasting] = struct{}{}
+		}
 		c.mu.Unlock()
 
+		// Rejected meanwhile, e.g. by a stream exceeding the quota, or unsubscribed.
+		if rejected {
+			c.pubsub.Unsubscribe(c, broadcasting)
+
+			return
+		}
+
+		logger.Debug(fmt.Sprintf("%s is streaming from %s", c.Name, broadcasting))
+
 		c.transmitSubscriptionConfirmation()
 	}()
 }
 
+// Mark a stream of StreamFrom subscribed to, or failed.
+func (c *Channel) settleStream() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subscribingStreams--
+
+	if c.subscribingStreams == 0 {
+		c.streamsSettled.Broadcast()
+	}
+}
+
+// The broadcastings streamed from, after the streams being subscribed to are settled.
+func (c *Channel) settledStreams() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.subscribingStreams > 0 {
+		c.streamsSettled.Wait()
+	}
+
+	streams := make([]string, 0, len(c.streams))
+	for broadcasting := range c.streams {
+		streams = append(streams, broadcasting)
+	}
+
+	return streams
+}
+
 // Broadcast message directly to a named broadcasting. The message will later be JSON encoded.
 func (c *Channel) Broadcast(broadcasting string, message any) error {
 	msg, err := json.Marshal(message)
@@ -85,12 +263,28 @@ func (c *Channel) Broadcast(broadcasting string, message any) error {
 		return err
 	}
 
-	return c.pubsub.Broadcast(c.Name, broadcasting, msg)
+	return c.conn.cable.broadcast(c.Name, broadcasting, msg)
+}
+
+// Let the subscriber whisper to the broadcasting: the payloads of its `whisper` commands are relayed to the other
+// subscribers of the broadcasting as they are, bypassing PerformAction. The channel usually streams from it as well.
+// Could be called in the Subscribed callback.
+func (c *Channel) WhisperTo(broadcasting string) {
+	c.mu.Lock()
+	c.whisperTo = broadcasting
+	c.mu.Unlock()
 }
 
 // Unsubscribes all streams associated with this channel from the pubsub queue.
 func (c *Channel) StopAllStreams() {
+	c.mu.Lock()
+	broadcastings := make([]string, 0, len(c.streams))
 	for b := range c.streams {
+		broadcastings = append(broadcastings, b)
+	}
+	c.mu.Unlock()
+
+	for _, b := range broadcastings {
 		c.StopStreamFrom(b)
 	}
 }
@@ -99,20 +293,76 @@ func (c *Channel) StopAllStreams() {
 func (c *Channel) StopStreamFrom(broadcasting string) {
 	c.mu.Lock()
 	delete(c.streams, broadcasting)
+	delete(c.quotaStreams, broadcasting)
 	c.mu.Unlock()
 
-	go c.pubsub.Unsubscribe(c, broadcasting)
+	go func() {
+		c.pubsub.Unsubscribe(c, broadcasting)
+
+		// Keep the callback until unsubscribed, so the messages in flight don't bypass it.
+		c.mu.Lock()
+		if _, ok := c.streams[broadcasting]; !ok {
+			delete(c.streamHandlers, broadcasting)
+		}
+		c.mu.Unlock()
+	}()
 }
 
 // Transmit a hash of message to the subscriber. The hash will automatically be wrapped in a JSON envelope with
 // the proper channel identifier marked as the recipient.
 func (c *Channel) Transmit(message any) {
+	// The binary protocols can't embed the raw JSON, e.g. of RawStreamCoder.
+	if raw, ok := message.(json.RawMessage); ok {
+		if _, ok := c.conn.protocol.codec.(JSONCodec); !ok {
+			if err := json.Unmarshal(raw, &message); err != nil {
+				logger.Error(fmt.Sprintf("Decode message failed: %s, %v", raw, err))
+
+				return
+			}
+		}
+	}
+
 	m := channelMessage{
 		Identifier: c.Identifier,
 		Message:    message,
 	}
 
-	c.conn.send <- m
+	c.conn.enqueue(m)
+}
+
+// Transmit a broadcast message, along with its stream position for the extended protocols.
+func (c *Channel) transmitBroadcast(msg *broadcastMessage) {
+	c.mu.Lock()
+	h, ok := c.streamHandlers[msg.broadcasting]
+	c.mu.Unlock()
+
+	if ok {
+		h.handle(c, msg)
+
+		return
+	}
+
+	p := c.conn.protocol
+	message, err := msg.payload(p)
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("Decode message failed: %s, %v", msg.data, err))
+
+		return
+	}
+
+	m := channelMessage{
+		Identifier: c.Identifier,
+		Message:    message,
+	}
+
+	if p.extended && msg.position.Offset > 0 {
+		m.StreamID = msg.broadcasting
+		m.Epoch = msg.position.Epoch
+		m.Offset = msg.position.Offset
+	}
+
+	c.conn.enqueue(msg.frame(p, m))
 }
 
 // Reject a subscription. Could be called in the Subscribled callback.
@@ -126,8 +376,16 @@ func (c *Channel) subscribe() {
 	conn := c.conn
 	channelName := c.descrption.Name
 
+	c.mu.Lock()
+	c.subscribing = true
+	c.mu.Unlock()
+
 	c.descrption.Subscribed(c)
 
+	c.mu.Lock()
+	c.subscribing = false
+	c.mu.Unlock()
+
 	if c.isSubscriptionRejected {
 		c.rejectSubscription()
 		return
@@ -145,6 +403,8 @@ func (c *Channel) subscribe() {
 	}
 
 	conn.channels[channelName][c.Identifier] = c
+
+	c.startTimers()
 }
 
 func (c *Channel) unsubscribe() {
@@ -157,8 +417,19 @@ func (c *Channel) unsubscribe() {
 		c.conn.mu.Unlock()
 	}
 
-	for broadcasting := range c.streams {
-		c.pubsub.Unsubscribe(c, broadcasting)
+	c.stopTimers()
+	c.leaveAllPresences()
+
+	c.mu.Lock()
+	c.isUnsubscribed = true
+	broadcastings := make([]string, 0, len(c.streams))
+	for b := range c.streams {
+		broadcastings = append(broadcastings, b)
+	}
+	c.mu.Unlock()
+
+	for _, b := range broadcastings {
+		c.pubsub.Unsubscribe(c, b)
 	}
 	c.descrption.Unsubscribed(c)
 }
@@ -167,9 +438,67 @@ func (c *Channel) performAction(data string) {
 	if c.isSubscriptionRejected {
 		return
 	}
+
+	if c.descrption.routes != nil {
+		c.dispatchAction(data)
+
+		return
+	}
+
 	c.descrption.PerformAction(c, data)
 }
 
+func (c *Channel) whisper(data string) {
+	if c.isSubscriptionRejected {
+		return
+	}
+
+	c.mu.Lock()
+	broadcasting := c.whisperTo
+	allowed := c.allowWhisper(time.Now())
+	c.mu.Unlock()
+
+	if broadcasting == "" {
+		logger.Error(fmt.Sprintf("%s doesn't accept whispers", c.Name))
+
+		return
+	}
+
+	if !allowed {
+		logger.Debug(fmt.Sprintf("%s dropped a whisper exceeding the rate limit", c.Name))
+
+		return
+	}
+
+	if !json.Valid([]byte(data)) {
+		logger.Error(fmt.Sprintf("Malformed whisper: %s", data))
+
+		return
+	}
+
+	if err := c.conn.cable.whisper(c.Name, broadcasting, []byte(data), c.conn.sid); err != nil {
+		logger.Error(fmt.Sprintf("Whisper to %s failed: %v", broadcasting, err))
+	}
+}
+
+// Take a token of the whisper rate limit. It's called holding c.mu.
+func (c *Channel) allowWhisper(now time.Time) bool {
+	cfg := c.conn.cable.Config
+
+	if cfg.whisperRateLimit <= 0 || cfg.whisperRateInterval <= 0 {
+		return true
+	}
+
+	if c.whisperLimiter == nil {
+		c.whisperLimiter = newTokenBucket(RateLimit{
+			Burst: cfg.whisperRateLimit,
+			Every: cfg.whisperRateInterval / time.Duration(cfg.whisperRateLimit),
+		})
+	}
+
+	return c.whisperLimiter.take(now, false) == 0
+}
+
 func (c *Channel) rejectSubscription() {
 	c.unsubscribe()
 	c.transmitSubscriptionRejection()
@@ -183,6 +512,7 @@ func (c *Channel) transmitSubscriptionConfirmation() {
 	c.mu.Lock()
 
 	if c.isConfirmationSent {
+		c.mu.Unlock()
 		return
 	}
 
@@ -194,7 +524,7 @@ func (c *Channel) transmitSubscriptionConfirmation() {
 		"identifier": c.Identifier,
 		"type":       "confirm_subscription",
 	}
-	c.conn.send <- message
+	c.conn.enqueue(message)
 }
 
 func (c *Channel) transmitSubscriptionRejection() {
@@ -204,10 +534,12 @@ func (c *Channel) transmitSubscriptionRejection() {
 		"identifier": c.Identifier,
 		"type":       "reject_subscription",
 	}
-	c.conn.send <- message
+	c.conn.enqueue(message)
 }
 
-func newChannel(conn *Connection, identifier string, params json.RawMessage, cd *ChannelDescription, onBroadcast func(ch *Channel, msg []byte)) *Channel {
+// Fill in the missing callbacks. The registered descriptions are shared by the connections, so they're filled in
+// by RegisterChannel.
+func (cd *ChannelDescription) defaultCallbacks() {
 	if cd.Subscribed == nil {
 		cd.Subscribed = func(*Channel) {}
 	}
@@ -217,8 +549,12 @@ func newChannel(conn *Connection, identifier string, params json.RawMessage, cd
 	if cd.PerformAction == nil {
 		cd.PerformAction = func(*Channel, string) {}
 	}
+}
 
-	return &Channel{
+func newChannel(conn *Connection, identifier string, params json.RawMessage, cd *ChannelDescription, onBroadcast func(ch *Channel, msg *broadcastMessage)) *Channel {
+	cd.defaultCallbacks()
+
+	c := &Channel{
 		Name:           cd.Name,
 		conn:           conn,
 		ConnIdentifier: conn.identifier,
@@ -229,4 +565,7 @@ func newChannel(conn *Connection, identifier string, params json.RawMessage, cd
 		descrption:     cd,
 		streams:        map[string]struct{}{},
 	}
+	c.streamsSettled = sync.NewCond(&c.mu)
+
+	return c
 }
@@ -2,6 +2,7 @@ package actioncable
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"testing"
@@ -45,7 +46,7 @@ func TestStreamFromAndStopStreamFor(t *testing.T) {
 	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\",\"id\":1}"}`
 	ws.write([]byte(data))
 
-	msg := ws.messageBox[len(ws.messageBox)-1]
+	msg := ws.lastMessage()
 	confirmMessage, ok := msg.(map[string]string)
 
 	if !ok || confirmMessage["type"] != "confirm_subscription" {
@@ -58,14 +59,14 @@ func TestStreamFromAndStopStreamFor(t *testing.T) {
 		t.Error("Unexpected cable.PubSub type.")
 	}
 
-	if sm.subscribers["RoomChannel"]["room_1"] == nil {
+	if sm.subscribers("RoomChannel", "room_1") == nil {
 		t.Error("Didn't subscribe from RoomChannel#room_1")
 	}
 
 	data = `{"command":"message", "identifier":"{\"channel\":\"RoomChannel\",\"id\":1}", "data":"{\"action\":\"run\"}"}`
 	ws.write([]byte(data))
 
-	if sm.subscribers["RoomChannel"]["room_1"] != nil {
+	if sm.subscribers("RoomChannel", "room_1") != nil {
 		t.Error("Didn't unsubscribe from RoomChannel#room_1")
 	}
 }
@@ -95,7 +96,7 @@ func TestReject(t *testing.T) {
 	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\",\"name\":\"private\"}"}`
 	ws.write([]byte(data))
 
-	msg := ws.messageBox[len(ws.messageBox)-1]
+	msg := ws.lastMessage()
 	m, ok := msg.(map[string]string)
 
 	if !ok || m["type"] != "reject_subscription" {
@@ -105,7 +106,7 @@ func TestReject(t *testing.T) {
 	data = `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\",\"name\":\"normal\"}"}`
 	ws.write([]byte(data))
 
-	msg = ws.messageBox[len(ws.messageBox)-1]
+	msg = ws.lastMessage()
 	m, ok = msg.(map[string]string)
 
 	if !ok || m["type"] != "confirm_subscription" {
@@ -172,8 +173,8 @@ func TestBroadcast(t *testing.T) {
 	data = `{"command":"message", "identifier":"{\"channel\":\"RoomChannel\",\"id\":1}", "data":"{\"action\":\"send_message\", \"message\":\"Hello Actioncable!\"}"}`
 	ws1.write([]byte(data))
 
-	msg1 := ws1.messageBox[len(ws1.messageBox)-1]
-	msg2 := ws2.messageBox[len(ws2.messageBox)-1]
+	msg1 := ws1.lastMessage()
+	msg2 := ws2.lastMessage()
 
 	if cm, ok := msg1.(channelMessage); !ok {
 		t.Errorf("Unexpected message: %+v", msg1)
@@ -191,11 +192,13 @@ func TestBroadcast(t *testing.T) {
 		}
 	}
 
+	received1, received2 := len(ws1.messages()), len(ws2.messages())
 	cable.Broadcast("RoomChannel", "room_1", map[string]string{"hello": "actioncable"})
-	time.Sleep(5 * time.Millisecond)
+	ws1.waitMessages(t, received1+1)
+	ws2.waitMessages(t, received2+1)
 
-	msg1 = ws1.messageBox[len(ws1.messageBox)-1]
-	msg2 = ws2.messageBox[len(ws2.messageBox)-1]
+	msg1 = ws1.lastMessage()
+	msg2 = ws2.lastMessage()
 
 	if cm, ok := msg1.(channelMessage); !ok {
 		t.Errorf("Unexpected message: %+v", msg1)
@@ -213,3 +216,222 @@ func TestBroadcast(t *testing.T) {
 		}
 	}
 }
+
+func TestWhisper(t *testing.T) {
+	conn1, ws1 := newTestConnection("user1")
+	conn2, ws2 := newTestConnection("user2")
+	cable := conn1.cable
+	cable.Config.WithWhisperRateLimit(2, time.Minute)
+
+	conn2.cable = cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	conn1.Setup()
+	defer conn1.Close("test complete")
+
+	conn2.Setup()
+	defer conn2.Close("test complete")
+
+	performed := 0
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFrom("room_1")
+			c.WhisperTo("room_1")
+		},
+		PerformAction: func(c *Channel, data string) {
+			performed++
+		},
+	})
+
+	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`
+	ws1.write([]byte(data))
+	ws2.write([]byte(data))
+
+	sent1, sent2 := len(ws1.messages()), len(ws2.messages())
+
+	data = `{"command":"whisper", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"event\":\"typing\"}"}`
+	ws1.write([]byte(data))
+	ws1.write([]byte(data))
+	ws1.write([]byte(data))
+
+	if len(ws1.messages()) != sent1 {
+		t.Errorf("The whisper is echoed to the sender: %+v", ws1.messages()[sent1:])
+	}
+
+	if len(ws2.messages()) != sent2+2 {
+		t.Fatalf("Unexpected messages: %+v", ws2.messages()[sent2:])
+	}
+
+	if cm, ok := ws2.messages()[sent2].(channelMessage); !ok {
+		t.Errorf("Unexpected message: %+v", ws2.messages()[sent2])
+	} else {
+		if m, ok := cm.Message.(map[string]any); !ok || m["event"] != "typing" {
+			t.Errorf("Unexpected message: %+v", m)
+		}
+	}
+
+	if performed != 0 {
+		t.Error("The whisper reached PerformAction.")
+	}
+}
+
+// The PubSubs other than the built-in ones would echo the whispers to the senders.
+func TestWhisperUnsupportedPubSub(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub = struct{ PubSub }{cable.PubSub}
+
+	if err := cable.whisper("RoomChannel", "room_1", []byte(`{"event":"typing"}`), "sid"); !errors.Is(err, ErrWhisperUnsupported) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestWhisperRequiresOptIn(t *testing.T) {
+	conn1, ws1 := newTestConnection("user1")
+	conn2, ws2 := newTestConnection("user2")
+	cable := conn1.cable
+
+	conn2.cable = cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	conn1.Setup()
+	defer conn1.Close("test complete")
+
+	conn2.Setup()
+	defer conn2.Close("test complete")
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFrom("room_1")
+		},
+	})
+
+	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`
+	ws1.write([]byte(data))
+	ws2.write([]byte(data))
+
+	sent := len(ws2.messages())
+
+	ws1.write([]byte(`{"command":"whisper", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"event\":\"typing\"}"}`))
+
+	if len(ws2.messages()) != sent {
+		t.Errorf("Unexpected messages: %+v", ws2.messages()[sent:])
+	}
+}
+
+func TestStreamFromWith(t *testing.T) {
+	conn1, ws1 := newTestConnection("admin")
+	conn2, ws2 := newTestConnection("user")
+	cable := conn1.cable
+	conn2.cable = cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	conn1.Setup()
+	defer conn1.Close("test complete")
+
+	conn2.Setup()
+	defer conn2.Close("test complete")
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			// Redact the email for the non-admins, drop the internal messages.
+			c.StreamFromWith("room_1", func(c *Channel, message any) {
+				m := message.(map[string]any)
+
+				if m["internal"] == true {
+					return
+				}
+
+				if c.ConnIdentifier != "admin" {
+					delete(m, "email")
+				}
+
+				c.Transmit(m)
+			}, nil)
+
+			c.StreamFromWith("raw", func(c *Channel, message any) {
+				if _, ok := message.(json.RawMessage); !ok {
+					t.Errorf("Unexpected message: %T", message)
+				}
+
+				c.Transmit(message)
+			}, RawStreamCoder{})
+		},
+	})
+
+	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`
+	ws1.write([]byte(data))
+	ws2.write([]byte(data))
+
+	sent1, sent2 := len(ws1.messages()), len(ws2.messages())
+
+	cable.Broadcast("RoomChannel", "room_1", map[string]any{"internal": true})
+	cable.Broadcast("RoomChannel", "room_1", map[string]any{"name": "Bob", "email": "bob@example.com"})
+	cable.Broadcast("RoomChannel", "raw", map[string]any{"name": "Alice"})
+	time.Sleep(10 * time.Millisecond)
+
+	if len(ws1.messages()) != sent1+2 || len(ws2.messages()) != sent2+2 {
+		t.Fatalf("Unexpected messages: %+v, %+v", ws1.messages()[sent1:], ws2.messages()[sent2:])
+	}
+
+	// The messages of the streams could arrive in any order.
+	split := func(box []any) (map[string]any, json.RawMessage) {
+		var (
+			m   map[string]any
+			raw json.RawMessage
+		)
+
+		for _, msg := range box {
+			switch v := msg.(channelMessage).Message.(type) {
+			case map[string]any:
+				m = v
+			case json.RawMessage:
+				raw = v
+			}
+		}
+
+		return m, raw
+	}
+
+	m1, raw := split(ws1.messages()[sent1:])
+	m2, _ := split(ws2.messages()[sent2:])
+
+	if m1["email"] != "bob@example.com" || m2["email"] != nil || m2["name"] != "Bob" {
+		t.Errorf("Unexpected messages: %+v, %+v", m1, m2)
+	}
+
+	if string(raw) != `{"name":"Alice"}` {
+		t.Errorf("Unexpected raw message: %s", raw)
+	}
+}
+
+func TestUnsubscribeDuringStreamFrom(t *testing.T) {
+	conn, _ := newTestConnection("user1")
+	pubsub := &blockingPubSub{SubscriberMap: &SubscriberMap{}, release: make(chan struct{})}
+	conn.cable.PubSub = pubsub
+
+	ch := newChannel(conn, `{"channel":"RoomChannel"}`, nil, &ChannelDescription{Name: "RoomChannel"}, nil)
+	ch.StreamFrom("room_1")
+
+	// The subscription in flight undoes itself once the channel is unsubscribed.
+	ch.unsubscribe()
+	close(pubsub.release)
+	ch.settledStreams()
+
+	if subscribers := pubsub.subscribers("RoomChannel", "room_1"); len(subscribers) != 0 {
+		t.Errorf("The unsubscribed channel is still subscribed: %v", subscribers)
+	}
+
+	if len(ch.streams) != 0 {
+		t.Errorf("Unexpected streams: %v", ch.streams)
+	}
+}
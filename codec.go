@@ -0,0 +1,83 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// The WebSocket subprotocols supported out of the box.
+const (
+	jsonProtocol    = "actioncable-v1-json"
+	msgpackProtocol = "actioncable-v1-msgpack"
+	// actioncable-v1-json plus stream positions in channel messages and the history command.
+	extJSONProtocol = "actioncable-v1-ext-json"
+)
+
+// Returned by Cable.Handle when the client doesn't offer any registered subprotocol.
+var ErrUnsupportedProtocol = errors.New("actioncable: no supported subprotocol offered by the client")
+
+// A Codec encodes the frames sent to the client and decodes the commands received from the client
+// for a WebSocket subprotocol. Register it by config.WithProtocol.
+type Codec interface {
+	// The WebSocket frame type of the encoded frames, websocket.TextMessage or websocket.BinaryMessage.
+	FrameType() int
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// A Codec could implement PayloadEncoder to encode the payload of a broadcast once for all the subscribers.
+// The returned value is embedded into every channel message and must be encodable by the Codec.
+type PayloadEncoder interface {
+	EncodePayload(payload any) (any, error)
+}
+
+// Codec for actioncable-v1-json.
+type JSONCodec struct{}
+
+var _ Codec = JSONCodec{}
+
+func (JSONCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// JSON frames are written through IConn.WriteJSON, which encodes straight into the frame writer.
+func (JSONCodec) writeFrame(wsConn IConn, v any) error {
+	return wsConn.WriteJSON(v)
+}
+
+type protocol struct {
+	name  string
+	codec Codec
+	// Whether the protocol supports the stream history.
+	extended bool
+}
+
+// Codecs writing frames by themselves instead of Marshal + IConn.WriteMessage.
+type frameWriter interface {
+	writeFrame(wsConn IConn, v any) error
+}
+
+// Write a message to the WebSocket connection encoded by the codec.
+func writeMessage(wsConn IConn, codec Codec, msg any) error {
+	if w, ok := codec.(frameWriter); ok {
+		return w.writeFrame(wsConn, msg)
+	}
+
+	b, err := codec.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return wsConn.WriteMessage(codec.FrameType(), b)
+}
@@ -0,0 +1,80 @@
+package actioncable
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	cfg := NewConfig()
+
+	if p := cfg.negotiateProtocol([]string{msgpackProtocol, jsonProtocol}); p == nil || p.name != jsonProtocol {
+		t.Errorf("Unexpected protocol: %+v", p)
+	}
+
+	if p := cfg.negotiateProtocol([]string{msgpackProtocol}); p == nil || p.name != msgpackProtocol {
+		t.Errorf("Unexpected protocol: %+v", p)
+	}
+
+	if p := cfg.negotiateProtocol([]string{"actioncable-unsupported"}); p != nil {
+		t.Errorf("Unexpected protocol: %+v", p)
+	}
+
+	if p := cfg.negotiateProtocol(nil); p != nil {
+		t.Errorf("Unexpected protocol: %+v", p)
+	}
+
+	cfg.WithProtocol(jsonProtocol, MsgpackCodec{})
+
+	if len(cfg.protocols) != 4 {
+		t.Error("WithProtocol didn't replace the registered protocol.")
+	}
+
+	if p := cfg.negotiateProtocol([]string{jsonProtocol}); p.codec != (MsgpackCodec{}) {
+		t.Errorf("Unexpected codec: %+v", p.codec)
+	}
+}
+
+func TestHandleNegotiatesProtocol(t *testing.T) {
+	cable := newTestCable()
+
+	errs := make(chan error, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errs <- cable.Handle(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, resp, err := (&websocket.Dialer{Subprotocols: []string{"actioncable-unsupported"}}).Dial(url, nil)
+
+	if err == nil || resp.StatusCode != http.StatusBadRequest || !errors.Is(<-errs, ErrUnsupportedProtocol) {
+		t.Errorf("The unsupported subprotocol is not rejected: %v", err)
+	}
+
+	ws, _, err := (&websocket.Dialer{Subprotocols: []string{msgpackProtocol}}).Dial(url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if ws.Subprotocol() != msgpackProtocol {
+		t.Errorf("Unexpected subprotocol: %s", ws.Subprotocol())
+	}
+
+	frameType, frame, err := ws.ReadMessage()
+
+	if err != nil || frameType != websocket.BinaryMessage {
+		t.Fatalf("Unexpected welcome frame: %d, %v", frameType, err)
+	}
+
+	if m := decodeMsgpackFrame(t, frame); m["type"] != "welcome" {
+		t.Errorf("Unexpected welcome message: %+v", m)
+	}
+}
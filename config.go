@@ -3,6 +3,7 @@ package actioncable
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -18,6 +19,29 @@ type config struct {
 	authenticator          func(*http.Request) (identifier any, pass bool)
 	rescuer                func(conn *Connection, exception any)
 	pubsub                 PubSub
+	// In the order of preference.
+	protocols     []*protocol
+	history       HistoryStore
+	sessions      SessionStore
+	sessionWindow time.Duration
+	// long-polling transport
+	pollTimeout        time.Duration
+	pollSessionTimeout time.Duration
+	// whispers allowed per subscription in the interval
+	whisperRateLimit    int
+	whisperRateInterval time.Duration
+	presence            PresenceStore
+	presenceTTL         time.Duration
+	onConnect           func(conn *Connection)
+	onDisconnect        func(conn *Connection, reason DisconnectReason)
+	quotas              Quotas
+	// the command middlewares chained around dispatchCommand
+	middlewares    []CommandMiddleware
+	commandHandler CommandHandler
+	// the outbound messages per connection, see WithSendQueue.
+	sendQueueSize   int
+	sendQueuePolicy OverflowPolicy
+	writeTimeout    time.Duration
 }
 
 // Return default actioncable config.
@@ -28,12 +52,25 @@ func NewConfig() *config {
 		writeBufferSize:        4096,
 		maxMessageSize:         65535,
 		broadcastConcurrentNum: 100,
+		pollTimeout:            25 * time.Second,
+		pollSessionTimeout:     time.Minute,
+		whisperRateLimit:       10,
+		whisperRateInterval:    time.Second,
+		sendQueueSize:          256,
+		sendQueuePolicy:        OverflowDropOldest,
+		writeTimeout:           10 * time.Second,
 		logger:                 &defaultLogger{info},
 		pubsub:                 &SubscriberMap{broadcastConcurrentNum: 100},
 		authenticator:          func(*http.Request) (any, bool) { return nil, true },
 		rescuer: func(c *Connection, e any) {
 			logger.Error(fmt.Sprintf("panic in channel callback: %v", e))
-			c.Close("internal server error")
+			c.close(DisconnectRescued, "internal server error")
+		},
+		protocols: []*protocol{
+			{name: extJSONProtocol, codec: JSONCodec{}, extended: true},
+			{name: jsonProtocol, codec: JSONCodec{}},
+			{name: msgpackProtocol, codec: MsgpackCodec{}},
+			{name: protobufProtocol, codec: ProtobufCodec{}},
 		},
 	}
 }
@@ -41,6 +78,7 @@ func NewConfig() *config {
 // Set the authentication function. The application could set the identifier by reading cookies or URL parameters from the *http.Request.
 // * The first return value is the identifier for the client connection.
 //   The identifier could be fetched by Connection.Identifier or Channel.ConnectionIdentifier.
+//   Return Identifiers for multiple named identifiers, e.g. the current user and the current account.
 // * The second return value determines whether the client connection passes the authentication.
 //   If it's false, the server will reject the client connection.
 func (c *config) WithAuthenticator(authenticator func(*http.Request) (any, bool)) *config {
@@ -60,6 +98,40 @@ func (c *config) WithRedisPubSub(opts *redis.Options) *config {
 	return c
 }
 
+// The client of the RedisPubSub, which the option requires. It's resolved by NewActionCable, so the options could
+// be called in any order.
+func (c *config) redisClient(option string) *redis.Client {
+	r, ok := c.pubsub.(*RedisPubSub)
+
+	if !ok {
+		panic(option + " requires WithRedisPubSub")
+	}
+
+	return r.Client
+}
+
+// Set the hook called once a connection is set up, e.g. to mark the user online.
+func (c *config) WithOnConnect(hook func(conn *Connection)) *config {
+	c.onConnect = hook
+	return c
+}
+
+// Set the hook called once a connection is closed, along with the reason. The connections rejected by the
+// authenticator are told DisconnectUnauthorized, they are never told connected. Their Identifier is nil, and their
+// SessionID is empty.
+func (c *config) WithOnDisconnect(hook func(conn *Connection, reason DisconnectReason)) *config {
+	c.onDisconnect = hook
+	return c
+}
+
+// Add the middlewares the incoming commands pass through, in the order they're added, see CommandMiddleware.
+func (c *config) WithCommandMiddleware(middlewares ...CommandMiddleware) *config {
+	c.middlewares = append(c.middlewares, middlewares...)
+	c.commandHandler = chainCommandMiddlewares(dispatchCommand, c.middlewares)
+
+	return c
+}
+
 // Set the function of how to handle panic.
 func (c *config) WithRescuer(r func(c *Connection, e any)) *config {
 	c.rescuer = r
@@ -115,3 +187,140 @@ func (c *config) WithBroadcastConcurrentNum(n int) *config {
 
 	return c
 }
+
+// Register a WebSocket subprotocol, or replace the codec of a registered one.
+// The server prefers the subprotocols in the order they are registered, actioncable-v1-ext-json,
+// actioncable-v1-json, actioncable-v1-msgpack and actioncable-v1-protobuf are registered by default.
+func (c *config) WithProtocol(name string, codec Codec) *config {
+	for _, p := range c.protocols {
+		if p.name == name {
+			p.codec = codec
+			return c
+		}
+	}
+
+	c.protocols = append(c.protocols, &protocol{name: name, codec: codec})
+	return c
+}
+
+// Keep the history of the broadcastings, so the clients of the extended protocols (actioncable-v1-ext-json)
+// could get the messages they missed replayed.
+func (c *config) WithHistory(store HistoryStore) *config {
+	c.history = store
+	return c
+}
+
+// Keep the history in the Redis of the RedisPubSub, so it's shared by all the nodes. It requires WithRedisPubSub,
+// in any order, NewActionCable panics without it. The size and the TTL must be positive.
+func (c *config) WithRedisHistory(size int, ttl time.Duration) *config {
+	if size <= 0 || ttl <= 0 {
+		panic(fmt.Sprintf("invalid history size or TTL: %d, %v", size, ttl))
+	}
+
+	c.history = &RedisHistory{Size: size, TTL: ttl}
+	return c
+}
+
+// Keep the sessions of the closed connections for the window, so the reconnecting clients presenting
+// the restore token (`restore_token` URL parameter) get their subscriptions restored without the Subscribed
+// callbacks re-run, once authenticated with the same identifiers. The sessions are kept in Redis if
+// WithRedisPubSub is used, otherwise in memory. A non-positive window disables the restoration.
+func (c *config) WithSessionRestoration(window time.Duration) *config {
+	c.sessionWindow = window
+	return c
+}
+
+// Whether the sessions are kept for restoration, which requires both the window and the store.
+func (c *config) sessionRestoration() bool {
+	return c.sessionWindow > 0 && c.sessions != nil
+}
+
+// Set the specific SessionStore implementation for the session restoration, see WithSessionRestoration.
+func (c *config) WithSessionStore(store SessionStore) *config {
+	c.sessions = store
+	return c
+}
+
+// Set how long a poll of the long-polling transport waits for the frames, and how long a session could go
+// without being polled before it's closed. Both must be positive.
+func (c *config) WithLongPolling(pollTimeout, sessionTimeout time.Duration) *config {
+	if pollTimeout <= 0 || sessionTimeout <= 0 {
+		panic(fmt.Sprintf("invalid long-polling timeouts: %v, %v", pollTimeout, sessionTimeout))
+	}
+
+	c.pollTimeout = pollTimeout
+	c.pollSessionTimeout = sessionTimeout
+	return c
+}
+
+// Limit the whispers a subscription could send in the interval (by a token bucket refilled evenly over the
+// interval), the ones exceeding are dropped.
+// It's 10 whispers per second by default, a non-positive limit disables the rate limiting.
+func (c *config) WithWhisperRateLimit(limit int, interval time.Duration) *config {
+	c.whisperRateLimit = limit
+	c.whisperRateInterval = interval
+	return c
+}
+
+// Track the presence of the members in the streams (see Channel.JoinPresence). The sessions of the members are
+// kept alive by the heartbeat of their nodes, and expire after the TTL once the node is gone. The TTL must be
+// positive.
+func (c *config) WithPresence(store PresenceStore, ttl time.Duration) *config {
+	if store != nil && ttl <= 0 {
+		panic(fmt.Sprintf("invalid presence TTL: %v", ttl))
+	}
+
+	c.presence = store
+	c.presenceTTL = ttl
+	return c
+}
+
+// Track the presence in the Redis of the RedisPubSub, so it's shared by all the nodes. It requires WithRedisPubSub,
+// in any order, NewActionCable panics without it.
+func (c *config) WithRedisPresence(ttl time.Duration) *config {
+	return c.WithPresence(&RedisPresence{}, ttl)
+}
+
+// Cap the subscriptions, streams and connections, see Quotas.
+func (c *config) WithQuotas(q Quotas) *config {
+	c.quotas = q
+	return c
+}
+
+// Cap them with the connections of the identifiers counted in the Redis of the RedisPubSub, so the cap is
+// cluster-wide. It requires WithRedisPubSub, in any order, NewActionCable panics without it.
+func (c *config) WithRedisQuotas(q Quotas) *config {
+	q.Store = &RedisConnectionQuota{}
+
+	return c.WithQuotas(q)
+}
+
+// Bound the messages queued for each connection, so a slow client doesn't stall the broadcasts to the others.
+// The policy decides what to do once the queue is full, see OverflowPolicy.
+// It's 256 messages with OverflowDropOldest by default, so no connection is closed for being slow unless opted in
+// with OverflowDisconnect.
+func (c *config) WithSendQueue(size int, policy OverflowPolicy) *config {
+	c.sendQueueSize = size
+	c.sendQueuePolicy = policy
+	return c
+}
+
+// Close the connections with DisconnectSlowConsumer once writing a message to them takes longer than the timeout.
+// It's 10 seconds by default, a non-positive timeout disables it. Only the WebSocket connections support it.
+func (c *config) WithWriteTimeout(timeout time.Duration) *config {
+	c.writeTimeout = timeout
+	return c
+}
+
+// Pick the preferred protocol among the subprotocols offered by the client.
+func (c *config) negotiateProtocol(offered []string) *protocol {
+	for _, p := range c.protocols {
+		for _, name := range offered {
+			if name == p.name {
+				return p
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,20 +1,26 @@
 package actioncable
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 const (
 	beatInterval = 3 * time.Second
 )
 
-// The APIs actioncable would use from *websocket.Conn
+// The APIs actioncable would use from *websocket.Conn. The other transports (e.g. Server-Sent Events) implement it as well.
 type IConn interface {
 	// WriteJSON writes the JSON encoding of v as a message.
 	WriteJSON(any) error
+	// WriteMessage is a helper method for getting a writer using NextWriter, writing the message and closing the writer.
+	WriteMessage(messageType int, data []byte) error
 	// ReadMessage is a helper method for getting a reader using NextReader and reading from that reader to a buffer.
 	ReadMessage() (int, []byte, error)
 	// Close closes the underlying network connection without sending or waiting for a close message.
@@ -24,17 +30,99 @@ type IConn interface {
 // For every WebSocket connection the Action Cable server accepts, a Connection object will be instantiated.
 type Connection struct {
 	// the value returned from config.authenticator(*http.Request)
-	identifier    any
-	wsConn        IConn
+	identifier any
+	wsConn     IConn
+	// the negotiated subprotocol, e.g. actioncable-v1-json
+	protocol *protocol
+	// the session ID, which is sent to the client in the welcome message.
+	sid string
+	// the secret the reconnecting client presents to restore the session, see config.WithSessionRestoration.
+	restoreToken string
+	// the session to restore in Setup.
+	session       *Session
+	connectedAt   time.Time
 	closed        bool
 	isInitialized bool
 	cable         *Cable
-	send          chan any
+	send          *sendQueue
 	done          chan struct{}
 	// key hierarchy: ChannelName -> SubscriptionIdentifier
 	channels        map[string]map[string]*Channel
 	internalChannel *Channel
-	mu              sync.Mutex
+	// the token buckets of the rate limits, see LimitCommands.
+	rateLimits map[string]*tokenBucket
+	// set while the rescuer is handling a panic, so the connection it closes is told rescued.
+	rescuing bool
+	mu       sync.Mutex
+	// held writing to wsConn, which supports one concurrent writer.
+	writeMu sync.Mutex
+}
+
+// Why a connection is closed, see config.WithOnDisconnect.
+type DisconnectReason int
+
+const (
+	// The client closed the connection (e.g. the page is closed).
+	DisconnectClientClosed DisconnectReason = iota + 1
+	// Reading from the client failed unexpectedly (e.g. the network is down).
+	DisconnectReadError
+	// Closed by Cable.DisconnectRemoteConnection.
+	DisconnectRemote
+	// Closed by Cable.Stop.
+	DisconnectServerShutdown
+	// Closed by the rescuer handling a panic in the callbacks.
+	DisconnectRescued
+	// The connection is rejected by the authenticator.
+	DisconnectUnauthorized
+	// Closed by the application calling Connection.Close.
+	DisconnectServerClosed
+	// Closed for exceeding the rate limits, see RateLimitDisconnect.
+	DisconnectRateLimited
+	// The new connection is rejected for exceeding the connection quotas, it's never told connected.
+	DisconnectQuotaExceeded
+	// Closed to make room for a new connection of the identifier, see Quotas.EvictOldest.
+	DisconnectEvicted
+	// The client read too slowly: its send queue overflowed with OverflowDisconnect, or a write timed out.
+	DisconnectSlowConsumer
+	// The long-polling client stopped polling for the session timeout, see config.WithLongPolling.
+	DisconnectPollExpired
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectClientClosed:
+		return "client closed"
+	case DisconnectReadError:
+		return "read error"
+	case DisconnectRemote:
+		return "remote disconnect"
+	case DisconnectServerShutdown:
+		return "server shutdown"
+	case DisconnectRescued:
+		return "rescued"
+	case DisconnectUnauthorized:
+		return "unauthorized"
+	case DisconnectServerClosed:
+		return "server closed"
+	case DisconnectRateLimited:
+		return "rate limited"
+	case DisconnectQuotaExceeded:
+		return "quota exceeded"
+	case DisconnectEvicted:
+		return "evicted"
+	case DisconnectSlowConsumer:
+		return "slow consumer"
+	case DisconnectPollExpired:
+		return "poll expired"
+	default:
+		return fmt.Sprintf("DisconnectReason(%d)", int(r))
+	}
+}
+
+// The session is kept for restoration if the client is gone involuntarily, and the client is told to reconnect.
+func (r DisconnectReason) restorable() bool {
+	return r == DisconnectClientClosed || r == DisconnectReadError || r == DisconnectServerShutdown ||
+		r == DisconnectSlowConsumer
 }
 
 // Setup connection.
@@ -46,9 +134,32 @@ func (conn *Connection) Setup() {
 		return
 	}
 
+	conn.connectedAt = time.Now()
+	welcome := &welcomeMessage{Type: "welcome", Sid: conn.sid}
+
+	if conn.cable.Config.sessionRestoration() {
+		welcome.RestoreToken = conn.restoreToken
+	}
+
+	var restored []restoredSubscription
+
+	if conn.session != nil {
+		restored = conn.restoreSubscriptions(conn.session)
+		conn.session = nil
+		welcome.Restored = true
+		welcome.RestoredIDs = make([]string, 0, len(restored))
+
+		for _, r := range restored {
+			welcome.RestoredIDs = append(welcome.RestoredIDs, r.channel.Identifier)
+		}
+
+		logger.Debug(fmt.Sprintf("Restored subscriptions: %v", welcome.RestoredIDs))
+	}
+
 	go conn.serveReading()
 	go conn.serveWriting()
-	conn.send <- welcomeMessage
+	conn.enqueue(welcome)
+	conn.resumeSubscriptions(restored)
 	conn.subscribeToInternalChannel()
 	conn.setupHeartbeatTimer()
 
@@ -57,22 +168,48 @@ func (conn *Connection) Setup() {
 
 // Close connection and clean up.
 func (conn *Connection) Close(reason string) {
+	conn.mu.Lock()
+	r := DisconnectServerClosed
+	if conn.rescuing {
+		r = DisconnectRescued
+	}
+	conn.mu.Unlock()
+
+	conn.close(r, reason)
+}
+
+// The identifier of the connection, i.e. the value returned from config.authenticator(*http.Request).
+func (conn *Connection) Identifier() any {
+	return conn.identifier
+}
+
+// The session ID of the connection.
+func (conn *Connection) SessionID() string {
+	return conn.sid
+}
+
+// Close connection, the session is kept for restoration if the reason is restorable.
+func (conn *Connection) close(r DisconnectReason, reason string) {
 	logger.Debug("Close connection due to " + reason)
 	conn.mu.Lock()
 
 	if conn.closed {
+		conn.mu.Unlock()
 		logger.Debug("The connection has already been closed.")
 		return
 	}
 	conn.closed = true
 	conn.mu.Unlock()
 
-	delete(conn.cable.connections, conn)
+	conn.cable.Connections.remove(conn)
+	conn.cable.releaseConnectionQuota(conn)
 
-	for channelName := range conn.channels {
-		for _, ch := range conn.channels[channelName] {
-			ch.unsubscribe()
-		}
+	if r.restorable() {
+		conn.saveSession()
+	}
+
+	for _, ch := range conn.subscriptions() {
+		ch.unsubscribe()
 	}
 
 	if conn.internalChannel != nil {
@@ -80,19 +217,50 @@ func (conn *Connection) Close(reason string) {
 	}
 
 	close(conn.done)
-	closeConnection(conn.wsConn, reason, false)
+	conn.writeMu.Lock()
+	closeConnection(conn.wsConn, conn.protocol.codec, reason, r.restorable())
+	conn.writeMu.Unlock()
+
+	if onDisconnect := conn.cable.Config.onDisconnect; onDisconnect != nil {
+		onDisconnect(conn, r)
+	}
 }
 
-func (conn *Connection) writeJsonMessage(msg interface{}) error {
-	return conn.wsConn.WriteJSON(msg)
+func (conn *Connection) isClosed() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return conn.closed
+}
+
+func (conn *Connection) writeMessage(msg any) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+
+	if f, ok := msg.(*preparedFrame); ok {
+		return f.write(conn.wsConn)
+	}
+
+	return writeMessage(conn.wsConn, conn.protocol.codec, msg)
+}
+
+// Hand the panic to the rescuer. It must be deferred by the callers.
+func (conn *Connection) rescuePanic() {
+	if r := recover(); r != nil {
+		conn.mu.Lock()
+		conn.rescuing = true
+		conn.mu.Unlock()
+
+		conn.cable.Config.rescuer(conn, r)
+
+		conn.mu.Lock()
+		conn.rescuing = false
+		conn.mu.Unlock()
+	}
 }
 
 func (conn *Connection) executeCommand(cmd *command) error {
-	defer func() {
-		if r := recover(); r != nil {
-			conn.cable.Config.rescuer(conn, r)
-		}
-	}()
+	defer conn.rescuePanic()
 
 	logger.Debug(fmt.Sprintf("Receive command %+v", cmd))
 
@@ -110,20 +278,27 @@ func (conn *Connection) executeCommand(cmd *command) error {
 		return fmt.Errorf("didn't find channel: %s", cmd.Identifier)
 	}
 
-	switch cmd.Command {
-	case "subscribe":
-		conn.addSubscription(c.ChannelName, cmd.Identifier, json.RawMessage(cmd.Identifier))
-	case "unsubscribe":
-		conn.removeSubscription(c.ChannelName, cmd.Identifier)
-	case "message":
-		conn.performAction(c.ChannelName, cmd.Identifier, cmd.Data)
-	default:
-		logger.Error(fmt.Sprintf("Received unrecognized command %+v", cmd))
+	handler := conn.cable.Config.commandHandler
+
+	if handler == nil {
+		handler = dispatchCommand
+	}
+
+	err := handler(conn, &Command{
+		Command:    cmd.Command,
+		Identifier: cmd.Identifier,
+		Channel:    c.ChannelName,
+		Data:       cmd.Data,
+		history:    cmd.History,
+	})
 
-		return fmt.Errorf("received unrecognized command %+v", cmd)
+	// The connection closed by the command, e.g. by RateLimitDisconnect, isn't sent the rejection.
+	if err != nil && cmd.Command == "subscribe" && !conn.isClosed() {
+		logger.Info(fmt.Sprintf("Rejected the subscription to %s: %v", cmd.Identifier, err))
+		conn.enqueue(map[string]string{"identifier": cmd.Identifier, "type": "reject_subscription"})
 	}
 
-	return nil
+	return err
 }
 
 func (conn *Connection) addSubscription(channelName, subId string, params json.RawMessage) {
@@ -137,27 +312,35 @@ func (conn *Connection) addSubscription(channelName, subId string, params json.R
 		return
 	}
 
-	c := newChannel(conn, subId, params, cd, func(ch *Channel, msg []byte) {
-		var message any
-		if err := json.Unmarshal(msg, &message); err != nil {
-			logger.Error(fmt.Sprintf("Unmarshal message failed: %+v ", msg))
+	c := newChannel(conn, subId, params, cd, defaultOnBroadcast)
 
-			return
-		}
+	if !conn.allowSubscription(subId) {
+		logger.Info(fmt.Sprintf("%v exceeded the quota of subscriptions by %s", conn.identifier, subId))
+		c.transmitSubscriptionRejection()
+
+		return
+	}
 
-		ch.Transmit(message)
-	})
 	c.subscribe()
 }
 
+// Transmit the broadcasts of the streams to the subscriber.
+func defaultOnBroadcast(ch *Channel, msg *broadcastMessage) {
+	if msg.exclude != "" && msg.exclude == ch.conn.sid {
+		return
+	}
+
+	if ch.holdBack(msg) {
+		return
+	}
+
+	ch.transmitBroadcast(msg)
+}
+
 func (conn *Connection) performAction(channelName, subId, data string) {
 	logger.Debug(fmt.Sprintf("performAction %s, %s, %s", channelName, subId, data))
 
-	var c *Channel
-
-	if _, ok := conn.channels[channelName]; ok {
-		c = conn.channels[channelName][subId]
-	}
+	c := conn.channel(channelName, subId)
 
 	if c == nil {
 		logger.Error("performAction failed: Channel not found: " + channelName)
@@ -168,32 +351,83 @@ func (conn *Connection) performAction(channelName, subId, data string) {
 	c.performAction(data)
 }
 
-func (conn *Connection) removeSubscription(channelName, subId string) {
-	var c *Channel
+func (conn *Connection) whisper(channelName, subId, data string) {
+	c := conn.channel(channelName, subId)
+
+	if c == nil {
+		logger.Error("whisper failed: Channel not found: " + channelName)
 
-	if _, ok := conn.channels[channelName]; ok {
-		c = conn.channels[channelName][subId]
+		return
 	}
 
+	c.whisper(data)
+}
+
+func (conn *Connection) replayHistory(channelName, subId string, req *historyRequest) {
+	c := conn.channel(channelName, subId)
+
+	if c == nil {
+		logger.Error("replayHistory failed: Channel not found: " + channelName)
+
+		return
+	}
+
+	c.replayHistory(req)
+}
+
+func (conn *Connection) removeSubscription(channelName, subId string) {
+	c := conn.channel(channelName, subId)
+
 	if c != nil {
 		logger.Debug(fmt.Sprintf("Unsubscribing from channel: %+v", c.Identifier))
 		c.unsubscribe()
 	}
 }
 
+// The subscription to the channel, or nil.
+func (conn *Connection) channel(channelName, subId string) *Channel {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return conn.channels[channelName][subId]
+}
+
+// All the subscriptions of the connection, which are unsubscribed without holding conn.mu.
+func (conn *Connection) subscriptions() []*Channel {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	subscriptions := []*Channel{}
+
+	for _, channels := range conn.channels {
+		for _, ch := range channels {
+			subscriptions = append(subscriptions, ch)
+		}
+	}
+
+	return subscriptions
+}
+
 func (conn *Connection) serveReading() {
 	for {
 		message, err := conn.read()
 
 		if err != nil {
-			// TODO: distinguish unexpected read fail.
-			conn.Close("close by client.")
+			if errors.Is(err, errPollExpired) {
+				conn.close(DisconnectPollExpired, "session expired.")
+			} else if isClientClose(err) {
+				conn.close(DisconnectClientClosed, "close by client.")
+			} else {
+				logger.Debug(fmt.Sprintf("Read failed: %v", err))
+				conn.close(DisconnectReadError, "read error.")
+			}
+
 			return
 		}
 
 		cmd := &command{}
 
-		if err := json.Unmarshal(message, cmd); err != nil {
+		if err := conn.decodeCommand(message, cmd); err != nil {
 			logger.Error(fmt.Sprintf("Can't unmarshal message %s due to %s.", message, err))
 			continue
 		}
@@ -202,46 +436,44 @@ func (conn *Connection) serveReading() {
 	}
 }
 
-func (conn *Connection) serveWriting() {
-	for {
-		select {
-		case <-conn.done:
-			return
-		case msg := <-conn.send:
-			if err := conn.writeJsonMessage(msg); err != nil {
-				logger.Error(fmt.Sprintf("Write message failed: %v", err))
-			}
-		}
-	}
-}
-
 func (conn *Connection) subscribeToInternalChannel() {
 	if conn.identifier == nil || conn.internalChannel != nil {
 		return
 	}
 
-	name := fmt.Sprintf("action_cable/%v", conn.identifier)
+	cd := &ChannelDescription{Name: internalChannelName}
+	ch := newChannel(conn, internalChannelName, nil, cd, func(ch *Channel, data *broadcastMessage) {
+		var msg remoteCommand
 
-	cd := &ChannelDescription{Name: name}
-	ch := newChannel(conn, name, nil, cd, func(ch *Channel, data []byte) {
-		var msg struct {
-			Type string `json:"type"`
+		if err := json.Unmarshal(data.data, &msg); err != nil {
+			logger.Error(fmt.Sprintf("Unmarshal internal message failed: %v", err))
 		}
 
-		if err := json.Unmarshal(data, &msg); err != nil {
-			logger.Error(fmt.Sprintf("Unmarshal internal message failed: %v", err))
+		if msg.Type != "disconnect" || !conn.Identifiers().includes(msg.Identifiers) {
+			return
+		}
+
+		if msg.Session != "" && msg.Session != conn.sid {
+			return
 		}
 
-		if msg.Type == "disconnect" {
-			logger.Info(fmt.Sprintf("Removing connection (%v)", conn.identifier))
-			conn.Close("close by remote.")
+		logger.Info(fmt.Sprintf("Removing connection (%v)", conn.identifier))
+
+		if msg.Reason == "evicted" {
+			conn.close(DisconnectEvicted, "evicted.")
+		} else {
+			conn.close(DisconnectRemote, "close by remote.")
 		}
 	})
 
-	if err := conn.cable.PubSub.Subscribe(ch, ch.Name); err != nil {
-		logger.Error(fmt.Sprintf("Subscribe the internal channel failed: %v", err))
+	for _, broadcasting := range append(internalBroadcastings(conn.identifier), sessionBroadcasting(conn.sid)) {
+		if err := conn.cable.PubSub.Subscribe(ch, broadcasting); err != nil {
+			logger.Error(fmt.Sprintf("Subscribe the internal channel failed: %v", err))
 
-		return
+			continue
+		}
+
+		ch.streams[broadcasting] = struct{}{}
 	}
 
 	conn.internalChannel = ch
@@ -255,13 +487,12 @@ func (conn *Connection) setupHeartbeatTimer() {
 
 	go func() {
 		for {
-			time.Sleep(beatInterval)
-
-			if conn.closed {
+			select {
+			case <-conn.done:
 				return
+			case <-time.After(beatInterval):
+				conn.enqueue(newPingMessage())
 			}
-
-			conn.send <- newPingMessage()
 		}
 	}()
 }
@@ -271,14 +502,53 @@ func (conn *Connection) read() ([]byte, error) {
 	return message, err
 }
 
-func closeConnection(wsConn IConn, reason string, reconnect bool) error {
+func (conn *Connection) decodeCommand(message []byte, cmd *command) error {
+	return conn.protocol.codec.Unmarshal(message, cmd)
+}
+
+func closeConnection(wsConn IConn, codec Codec, reason string, reconnect bool) error {
 	defer wsConn.Close()
 
-	return wsConn.WriteJSON(&disconnectMessage{Type: "disconnect", Reason: reason, Reconnect: reconnect})
+	return writeMessage(wsConn, codec, &disconnectMessage{Type: "disconnect", Reason: reason, Reconnect: reconnect})
 }
 
-func rejectUnauthorizedConnection(wsConn IConn) error {
+// Whether the client is gone by closing the connection, rather than an unexpected failure.
+func isClientClose(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, errSSEClosed) ||
+		errors.Is(err, errPollClosed)
+}
+
+func (cb *Cable) rejectUnauthorizedConnection(wsConn IConn, p *protocol) error {
 	logger.Info("An unauthorized connection attempt was rejected.")
 
-	return closeConnection(wsConn, "unauthorized", false)
+	err := closeConnection(wsConn, p.codec, "unauthorized", false)
+	cb.notifyUnauthorized(wsConn, p)
+
+	return err
+}
+
+// Tell the OnDisconnect hook about a rejected connection, which is never set up. The hook is passed a closed
+// connection without an identifier, a session ID or subscriptions, whose transport could be nil (e.g. the SSE and
+// the long-polling ones), see config.WithOnDisconnect.
+func (cb *Cable) notifyUnauthorized(wsConn IConn, p *protocol) {
+	onDisconnect := cb.Config.onDisconnect
+
+	if onDisconnect == nil {
+		return
+	}
+
+	conn := &Connection{
+		wsConn:   wsConn,
+		protocol: p,
+		cable:    cb,
+		send:     newSendQueue(cb.Config.sendQueueSize, cb.Config.sendQueuePolicy),
+		done:     make(chan struct{}),
+		channels: map[string]map[string]*Channel{},
+		closed:   true,
+	}
+	close(conn.done)
+
+	onDisconnect(conn, DisconnectUnauthorized)
 }
@@ -2,33 +2,56 @@ package actioncable
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type testWsConnection struct {
-	readCn      chan []byte
+	readCn chan []byte
+	// receives once the reader is back for the next message, i.e. the previous one is executed.
+	idle        chan struct{}
 	done        chan struct{}
 	clientClose chan struct{}
 	messageBox  []any
 	isClosed    bool
+	mu          sync.Mutex
 }
 
 var _ IConn = (*testWsConnection)(nil)
 
 func (c *testWsConnection) WriteJSON(j any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.messageBox = append(c.messageBox, j)
 
 	return nil
 }
 
+func (c *testWsConnection) WriteMessage(_ int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messageBox = append(c.messageBox, data)
+
+	return nil
+}
+
 func (c *testWsConnection) ReadMessage() (int, []byte, error) {
-	select {
-	case m := <-c.readCn:
-		return 1, m, nil
-	case <-c.clientClose:
-		return 1, nil, errors.New("connection is closed.")
+	for {
+		select {
+		case c.idle <- struct{}{}:
+		case m := <-c.readCn:
+			return 1, m, nil
+		case <-c.clientClose:
+			return 1, nil, errors.New("connection is closed.")
+		}
 	}
 }
 
@@ -40,24 +63,76 @@ func (c *testWsConnection) Close() error {
 
 func (c *testWsConnection) write(b []byte) {
 	c.readCn <- b
+
+	// Wait for the message to be executed, unless it closed the connection.
+	select {
+	case <-c.idle:
+	case <-c.done:
+	}
 	time.Sleep(5 * time.Millisecond)
 }
 
+// The messages written so far.
+func (c *testWsConnection) messages() []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]any{}, c.messageBox...)
+}
+
+func (c *testWsConnection) lastMessage() any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.messageBox) == 0 {
+		return nil
+	}
+
+	return c.messageBox[len(c.messageBox)-1]
+}
+
+// Wait for the connection to write at least n messages, which are written from the send queue asynchronously.
+func (c *testWsConnection) waitMessages(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		written := len(c.messageBox)
+		c.mu.Unlock()
+
+		if written >= n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("Timed out waiting for %d messages.", n)
+}
+
 func newTestConnection(id any) (*Connection, *testWsConnection) {
 	wsConn := &testWsConnection{
 		readCn:      make(chan []byte),
+		idle:        make(chan struct{}),
 		done:        make(chan struct{}),
 		clientClose: make(chan struct{}),
 		messageBox:  []any{},
 	}
 
+	cable := newTestCable()
+
 	return &Connection{
-		identifier: id,
-		wsConn:     wsConn,
-		cable:      newTestCable(),
-		send:       make(chan any),
-		done:       make(chan struct{}),
-		channels:   map[string]map[string]*Channel{},
+		identifier:   id,
+		wsConn:       wsConn,
+		protocol:     &protocol{name: jsonProtocol, codec: JSONCodec{}},
+		sid:          randomID(),
+		restoreToken: randomToken(),
+		cable:        cable,
+		send:         newSendQueue(cable.Config.sendQueueSize, cable.Config.sendQueuePolicy),
+		done:         make(chan struct{}),
+		channels:     map[string]map[string]*Channel{},
 	}, wsConn
 }
 
@@ -65,13 +140,14 @@ func TestConnectionSetup(t *testing.T) {
 	conn, ws := newTestConnection("test")
 	conn.Setup()
 	defer conn.Close("test complete")
+	ws.waitMessages(t, 1)
 
 	if !conn.isInitialized {
 		t.Error("The connection is not initialized.")
 	}
 
-	m, _ := ws.messageBox[0].(map[string]string)
-	if m["type"] != "welcome" {
+	m, _ := ws.messages()[0].(*welcomeMessage)
+	if m == nil || m.Type != "welcome" || m.Sid != conn.sid {
 		t.Error("Didn't send welcome message.")
 	}
 }
@@ -83,7 +159,7 @@ func TestClose(t *testing.T) {
 	close(ws.clientClose) // simulate sending a close message.
 	time.Sleep(5 * time.Millisecond)
 
-	if !conn.closed {
+	if !conn.isClosed() {
 		t.Error("The connection is not closed.")
 	}
 }
@@ -96,13 +172,13 @@ func TestExecuteCommandWrongMessage(t *testing.T) {
 	ws.write([]byte(`{"command":"random command", "identifier":"{\"channel\":\"ChatChannel\",\"room\":\"Best Room\"}"}`))
 
 	l := getCurrentTestLogger()
-	if !strings.HasPrefix(l.errorMessages[len(l.errorMessages)-1], "Received unrecognized command ") {
+	if !strings.HasPrefix(l.lastError(), "Received unrecognized command ") {
 		t.Error("didn't report unrecognized command")
 	}
 
 	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"ChatChannel\",\"room\":\"Best Room\"}"}`))
 
-	if l.errorMessages[len(l.errorMessages)-1] != "addSubscription failed: Channel not found: ChatChannel" {
+	if l.lastError() != "addSubscription failed: Channel not found: ChatChannel" {
 		t.Error("addSubscription check failed.")
 	}
 }
@@ -148,3 +224,123 @@ func TestExecuteCommand(t *testing.T) {
 		t.Error("didn't unsubscribe the channel.")
 	}
 }
+
+func TestDisconnectReasons(t *testing.T) {
+	reasons := make(chan DisconnectReason, 1)
+	newConnection := func() (*Connection, *testWsConnection) {
+		conn, ws := newTestConnection("user1")
+		conn.cable.Config.WithOnDisconnect(func(c *Connection, r DisconnectReason) { reasons <- r })
+
+		return conn, ws
+	}
+	expect := func(expected DisconnectReason) {
+		select {
+		case r := <-reasons:
+			if r != expected {
+				t.Errorf("Unexpected reason: %v, expected %v", r, expected)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("OnDisconnect is not called, expected %v", expected)
+		}
+	}
+
+	conn, ws := newConnection()
+	conn.Setup()
+	close(ws.clientClose)
+	expect(DisconnectReadError)
+
+	conn, ws = newConnection()
+	conn.Setup()
+	conn.Close("bye")
+	expect(DisconnectServerClosed)
+
+	if m, ok := ws.lastMessage().(*disconnectMessage); !ok || m.Reconnect {
+		t.Errorf("Unexpected disconnect message: %+v", ws.lastMessage())
+	}
+
+	// The clients of the restorable reasons are told to reconnect.
+	conn, ws = newConnection()
+	conn.Setup()
+	conn.close(DisconnectServerShutdown, "server is shutdown.")
+	expect(DisconnectServerShutdown)
+
+	if m, ok := ws.lastMessage().(*disconnectMessage); !ok || !m.Reconnect {
+		t.Errorf("Unexpected disconnect message: %+v", ws.lastMessage())
+	}
+
+	conn, ws = newConnection()
+	conn.cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(*Channel) { panic("oops") },
+	})
+	conn.Setup()
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	expect(DisconnectRescued)
+
+	conn, _ = newConnection()
+	conn.cable.PubSub.Run()
+	defer conn.cable.PubSub.Stop()
+	conn.Setup()
+	conn.cable.DisconnectRemoteConnection("user1")
+	expect(DisconnectRemote)
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+
+	connected := make(chan *Connection, 1)
+	reasons := make(chan DisconnectReason, 1)
+	pass := false
+
+	cable.Config.WithAuthenticator(func(*http.Request) (any, bool) { return "user1", pass }).
+		WithOnConnect(func(c *Connection) { connected <- c }).
+		WithOnDisconnect(func(c *Connection, r DisconnectReason) { reasons <- r })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cable.Handle(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dialer := &websocket.Dialer{Subprotocols: []string{jsonProtocol}}
+
+	ws, _, err := dialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws.ReadJSON(&map[string]any{})
+	ws.Close()
+
+	if r := <-reasons; r != DisconnectUnauthorized {
+		t.Errorf("Unexpected reason: %v", r)
+	}
+
+	pass = true
+
+	for _, expected := range []DisconnectReason{DisconnectClientClosed, DisconnectServerShutdown} {
+		ws, _, err := dialer.Dial(url, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c := <-connected; c.Identifier() != "user1" {
+			t.Errorf("Unexpected identifier: %v", c.Identifier())
+		}
+
+		if expected == DisconnectClientClosed {
+			ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		} else {
+			cable.Stop()
+		}
+
+		if r := <-reasons; r != expected {
+			t.Errorf("Unexpected reason: %v, expected %v", r, expected)
+		}
+
+		ws.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// The channel graphql-ruby's ActionCableLink subscribes to.
+const GraphqlChannelName = "GraphqlChannel"
+
+// A GraphQL operation sent by the `execute` action.
+type GraphqlRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// The outcome of an executed operation.
+type GraphqlResult struct {
+	// The GraphQL response, e.g. map[string]any{"data": ..., "errors": ...}.
+	Result any
+	// The ID of the subscription, set for the subscription operations only. The updates are then pushed by
+	// Cable.BroadcastGraphqlResult, until Cable.CompleteGraphqlSubscription.
+	SubscriptionID string
+}
+
+// Executes the GraphQL operations for GraphqlChannel, supplied by the application.
+type GraphqlExecutor interface {
+	// Execute the operation sent by the subscriber of the channel. An error is transmitted as the `errors` of
+	// the result, completing the operation.
+	Execute(c *Channel, req *GraphqlRequest) (*GraphqlResult, error)
+	// Tear down a subscription once the subscriber of the channel unsubscribes.
+	DeleteSubscription(subscriptionID string)
+}
+
+// The message ActionCableLink expects. The operation is completed once `more` is false.
+type graphqlPayload struct {
+	Result any  `json:"result,omitempty"`
+	More   bool `json:"more"`
+}
+
+// A channel compatible with the GraphqlChannel of graphql-ruby (the `ActionCableLink` protocol). Every
+// subscription of the channel `execute`s an operation by the executor, and streams the updates of the
+// subscription operations until unsubscribed.
+func NewGraphqlChannel(executor GraphqlExecutor) *ChannelDescription {
+	subscriptions := map[*Channel][]string{}
+	mu := sync.Mutex{}
+
+	return &ChannelDescription{
+		Name: GraphqlChannelName,
+		PerformAction: func(c *Channel, data string) {
+			action := struct {
+				Action        string          `json:"action"`
+				Query         string          `json:"query"`
+				Variables     json.RawMessage `json:"variables"`
+				OperationName string          `json:"operationName"`
+			}{}
+
+			if err := json.Unmarshal([]byte(data), &action); err != nil || action.Action != "execute" {
+				logger.Debug(fmt.Sprintf("%s ignored the action: %s", c.Name, data))
+
+				return
+			}
+
+			req := &GraphqlRequest{Query: action.Query, OperationName: action.OperationName}
+
+			if err := decodeGraphqlVariables(action.Variables, &req.Variables); err != nil {
+				c.Transmit(graphqlError(err))
+
+				return
+			}
+
+			res, err := executor.Execute(c, req)
+
+			if err != nil {
+				c.Transmit(graphqlError(err))
+
+				return
+			}
+
+			if res.SubscriptionID != "" {
+				mu.Lock()
+				subscriptions[c] = append(subscriptions[c], res.SubscriptionID)
+				mu.Unlock()
+
+				c.StreamFrom(graphqlStream(res.SubscriptionID))
+			}
+
+			c.Transmit(&graphqlPayload{Result: res.Result, More: res.SubscriptionID != ""})
+		},
+		Unsubscribed: func(c *Channel) {
+			mu.Lock()
+			ids := subscriptions[c]
+			delete(subscriptions, c)
+			mu.Unlock()
+
+			for _, id := range ids {
+				executor.DeleteSubscription(id)
+			}
+		},
+	}
+}
+
+// Push an update of a subscription operation to its subscriber.
+func (cb *Cable) BroadcastGraphqlResult(subscriptionID string, result any) error {
+	return cb.Broadcast(GraphqlChannelName, graphqlStream(subscriptionID), &graphqlPayload{Result: result, More: true})
+}
+
+// Complete a subscription operation, e.g. once the subscribed object is deleted.
+func (cb *Cable) CompleteGraphqlSubscription(subscriptionID string) error {
+	return cb.Broadcast(GraphqlChannelName, graphqlStream(subscriptionID), &graphqlPayload{More: false})
+}
+
+func graphqlStream(subscriptionID string) string {
+	return "graphql-subscription:" + subscriptionID
+}
+
+func graphqlError(err error) *graphqlPayload {
+	return &graphqlPayload{
+		Result: map[string]any{"errors": []map[string]string{{"message": err.Error()}}},
+		More:   false,
+	}
+}
+
+// The variables are either an object or a JSON encoded string of it.
+func decodeGraphqlVariables(raw json.RawMessage, variables *map[string]any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var s string
+
+	if json.Unmarshal(raw, &s) == nil {
+		if s == "" {
+			return nil
+		}
+
+		raw = json.RawMessage(s)
+	}
+
+	if err := json.Unmarshal(raw, variables); err != nil {
+		return fmt.Errorf("invalid variables: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testGraphqlExecutor struct {
+	requests []*GraphqlRequest
+	deleted  []string
+}
+
+func (e *testGraphqlExecutor) Execute(c *Channel, req *GraphqlRequest) (*GraphqlResult, error) {
+	e.requests = append(e.requests, req)
+
+	switch req.OperationName {
+	case "OnMessage":
+		return &GraphqlResult{Result: map[string]any{"data": map[string]any{}}, SubscriptionID: "sub1"}, nil
+	case "Broken":
+		return nil, errors.New("syntax error")
+	default:
+		return &GraphqlResult{Result: map[string]any{"data": map[string]any{"room": req.Variables["id"]}}}, nil
+	}
+}
+
+func (e *testGraphqlExecutor) DeleteSubscription(subscriptionID string) {
+	e.deleted = append(e.deleted, subscriptionID)
+}
+
+func lastMessageJSON(ws *testWsConnection) string {
+	b, _ := json.Marshal(ws.lastMessage())
+
+	return string(b)
+}
+
+func TestGraphqlChannel(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	cable := conn.cable
+	executor := &testGraphqlExecutor{}
+
+	cable.RegisterChannel(NewGraphqlChannel(executor))
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe","identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}"}`))
+
+	ws.write([]byte(`{"command":"message","identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","data":"{\"action\":\"execute\",\"query\":\"query Room { room }\",\"variables\":\"{\\\"id\\\":1}\",\"operationName\":\"Room\"}"}`))
+
+	if m := lastMessageJSON(ws); m != `{"identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","message":{"result":{"data":{"room":1}},"more":false}}` {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	ws.write([]byte(`{"command":"message","identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","data":"{\"action\":\"execute\",\"operationName\":\"Broken\"}"}`))
+
+	if m := lastMessageJSON(ws); m != `{"identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","message":{"result":{"errors":[{"message":"syntax error"}]},"more":false}}` {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	ws.write([]byte(`{"command":"message","identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","data":"{\"action\":\"execute\",\"query\":\"subscription OnMessage { message }\",\"variables\":{},\"operationName\":\"OnMessage\"}"}`))
+
+	if m := lastMessageJSON(ws); m != `{"identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","message":{"result":{"data":{}},"more":true}}` {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	cable.BroadcastGraphqlResult("sub1", map[string]any{"data": map[string]any{"message": "hello"}})
+	time.Sleep(5 * time.Millisecond)
+
+	if m := lastMessageJSON(ws); m != `{"identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","message":{"more":true,"result":{"data":{"message":"hello"}}}}` {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	cable.CompleteGraphqlSubscription("sub1")
+	time.Sleep(5 * time.Millisecond)
+
+	if m := lastMessageJSON(ws); m != `{"identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}","message":{"more":false}}` {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	ws.write([]byte(`{"command":"unsubscribe","identifier":"{\"channel\":\"GraphqlChannel\",\"channelId\":\"1\"}"}`))
+
+	if len(executor.deleted) != 1 || executor.deleted[0] != "sub1" {
+		t.Errorf("Unexpected deleted subscriptions: %v", executor.deleted)
+	}
+}
@@ -0,0 +1,279 @@
+package actioncable
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Returned by a HistoryStore when it can't tell the messages after a position, e.g. the epoch has changed
+// or the messages have been evicted.
+var ErrHistoryUnavailable = errors.New("actioncable: stream history is unavailable")
+
+// The position of a message in the history of a stream. The offsets of a stream increase monotonically within
+// an epoch, the epoch changes when the history is lost (e.g. the server restarts with a MemoryHistory).
+type StreamPosition struct {
+	Epoch  string `json:"epoch"`
+	Offset uint64 `json:"offset"`
+}
+
+type HistoryEntry struct {
+	StreamPosition
+	Data []byte
+	Time time.Time
+}
+
+// A bounded history of the messages published to the streams.
+type HistoryStore interface {
+	// Append a message to the history of the stream, returning its position.
+	Append(stream string, data []byte) (StreamPosition, error)
+	// The messages of the stream after the position. It returns ErrHistoryUnavailable if some of them are gone.
+	After(stream string, pos StreamPosition) ([]HistoryEntry, error)
+	// The messages of the stream published since the time.
+	Since(stream string, since time.Time) ([]HistoryEntry, error)
+}
+
+// A HistoryStore in the process memory. It only suits the applications running on a single node.
+type MemoryHistory struct {
+	size      int
+	ttl       time.Duration
+	epoch     string
+	streams   map[string]*memoryStream
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type memoryStream struct {
+	offset  uint64
+	entries []HistoryEntry
+}
+
+var _ HistoryStore = (*MemoryHistory)(nil)
+
+// Keep at most `size` messages per stream for the `ttl` duration. Both must be positive.
+func NewMemoryHistory(size int, ttl time.Duration) *MemoryHistory {
+	if size <= 0 || ttl <= 0 {
+		panic(fmt.Sprintf("invalid history size or TTL: %d, %v", size, ttl))
+	}
+
+	return &MemoryHistory{
+		size:      size,
+		ttl:       ttl,
+		epoch:     randomID(),
+		streams:   map[string]*memoryStream{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (h *MemoryHistory) Append(stream string, data []byte) (StreamPosition, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.sweep(now)
+
+	s, ok := h.streams[stream]
+
+	if !ok {
+		s = &memoryStream{}
+		h.streams[stream] = s
+	}
+
+	s.offset++
+	pos := StreamPosition{Epoch: h.epoch, Offset: s.offset}
+	s.entries = append(s.entries, HistoryEntry{StreamPosition: pos, Data: data, Time: now})
+
+	if len(s.entries) > h.size {
+		s.entries = s.entries[len(s.entries)-h.size:]
+	}
+
+	return pos, nil
+}
+
+func (h *MemoryHistory) After(stream string, pos StreamPosition) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if pos.Epoch != h.epoch {
+		return nil, ErrHistoryUnavailable
+	}
+
+	s, ok := h.streams[stream]
+
+	if !ok {
+		if pos.Offset == 0 {
+			return nil, nil
+		}
+
+		return nil, ErrHistoryUnavailable
+	}
+
+	entries := h.alive(s, time.Now())
+
+	if pos.Offset > s.offset || (len(entries) == 0 && pos.Offset < s.offset) || (len(entries) > 0 && entries[0].Offset > pos.Offset+1) {
+		return nil, ErrHistoryUnavailable
+	}
+
+	for i, e := range entries {
+		if e.Offset > pos.Offset {
+			return append([]HistoryEntry(nil), entries[i:]...), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (h *MemoryHistory) Since(stream string, since time.Time) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.streams[stream]
+
+	if !ok {
+		return nil, nil
+	}
+
+	entries := h.alive(s, time.Now())
+
+	for i, e := range entries {
+		if !e.Time.Before(since) {
+			return append([]HistoryEntry(nil), entries[i:]...), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Drop the expired entries of the stream and return the rest.
+func (h *MemoryHistory) alive(s *memoryStream, now time.Time) []HistoryEntry {
+	i := 0
+	for i < len(s.entries) && now.Sub(s.entries[i].Time) > h.ttl {
+		i++
+	}
+
+	s.entries = s.entries[i:]
+	return s.entries
+}
+
+// Drop the streams without any alive entry once per ttl. The offset of a dropped stream restarts from 1,
+// while the clients still ahead of it get ErrHistoryUnavailable.
+func (h *MemoryHistory) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < h.ttl {
+		return
+	}
+
+	h.lastSweep = now
+
+	for name, s := range h.streams {
+		if len(h.alive(s, now)) == 0 {
+			delete(h.streams, name)
+		}
+	}
+}
+
+// The history is kept per broadcasting of a channel.
+func historyStream(channelName, broadcasting string) string {
+	return channelName + "/" + broadcasting
+}
+
+// Replay the messages missed by the subscription before resuming the live ones.
+func (c *Channel) replayHistory(req *historyRequest) {
+	history := c.conn.cable.Config.history
+
+	if history == nil || !c.conn.protocol.extended || req == nil {
+		c.transmitHistoryResult("reject_history")
+
+		return
+	}
+
+	streams := c.settledStreams()
+
+	c.mu.Lock()
+	c.replaying = true
+	c.mu.Unlock()
+
+	replayed := map[string]StreamPosition{}
+	failed := false
+
+	for _, broadcasting := range streams {
+		var entries []HistoryEntry
+		var err error
+		stream := historyStream(c.Name, broadcasting)
+
+		if pos, ok := req.Streams[broadcasting]; ok {
+			entries, err = history.After(stream, pos)
+		} else if req.Since > 0 {
+			entries, err = history.Since(stream, time.Unix(req.Since, 0))
+		}
+
+		// The other streams are replayed anyway, but the history is rejected.
+		if err != nil {
+			logger.Error(fmt.Sprintf("Read the history of %s failed: %v", broadcasting, err))
+			failed = true
+
+			continue
+		}
+
+		for _, e := range entries {
+			msg := newBroadcastMessage(c.Name, broadcasting, e.Data)
+			msg.position = e.StreamPosition
+
+			c.transmitBroadcast(msg)
+			replayed[broadcasting] = e.StreamPosition
+		}
+	}
+
+	// Flush the live messages held back during the replay, skipping the replayed ones.
+	for {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+
+		if len(pending) == 0 {
+			c.replaying = false
+			c.mu.Unlock()
+
+			break
+		}
+		c.mu.Unlock()
+
+		for _, msg := range pending {
+			last, ok := replayed[msg.broadcasting]
+
+			if ok && msg.position.Epoch == last.Epoch && msg.position.Offset <= last.Offset {
+				continue
+			}
+
+			c.transmitBroadcast(msg)
+		}
+	}
+
+	if failed {
+		c.transmitHistoryResult("reject_history")
+	} else {
+		c.transmitHistoryResult("confirm_history")
+	}
+}
+
+// Hold back the live message if the history is being replayed.
+func (c *Channel) holdBack(msg *broadcastMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replaying {
+		c.pending = append(c.pending, msg)
+	}
+
+	return c.replaying
+}
+
+func (c *Channel) transmitHistoryResult(result string) {
+	logger.Debug(c.Name + " is transmitting " + result)
+
+	message := map[string]string{
+		"identifier": c.Identifier,
+		"type":       result,
+	}
+	c.conn.enqueue(message)
+}
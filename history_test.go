@@ -0,0 +1,296 @@
+package actioncable
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMemoryHistory(t *testing.T) {
+	h := NewMemoryHistory(2, time.Minute)
+
+	for i := 1; i <= 3; i++ {
+		pos, _ := h.Append("RoomChannel/room_1", []byte(fmt.Sprint(i)))
+
+		if pos.Offset != uint64(i) || pos.Epoch != h.epoch {
+			t.Errorf("Unexpected position: %+v", pos)
+		}
+	}
+
+	entries, err := h.After("RoomChannel/room_1", StreamPosition{Epoch: h.epoch, Offset: 2})
+
+	if err != nil || len(entries) != 1 || string(entries[0].Data) != "3" {
+		t.Errorf("Unexpected entries: %+v, %v", entries, err)
+	}
+
+	if entries, err := h.After("RoomChannel/room_1", StreamPosition{Epoch: h.epoch, Offset: 3}); err != nil || len(entries) != 0 {
+		t.Errorf("Unexpected entries: %+v, %v", entries, err)
+	}
+
+	// The first message is evicted.
+	if _, err := h.After("RoomChannel/room_1", StreamPosition{Epoch: h.epoch, Offset: 0}); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, err := h.After("RoomChannel/room_1", StreamPosition{Epoch: "stale", Offset: 2}); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, err := h.After("RoomChannel/room_1", StreamPosition{Epoch: h.epoch, Offset: 4}); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if entries, _ := h.Since("RoomChannel/room_1", time.Now().Add(-time.Second)); len(entries) != 2 {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+
+	if entries, _ := h.Since("RoomChannel/room_1", time.Now().Add(time.Second)); len(entries) != 0 {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestMemoryHistoryExpiration(t *testing.T) {
+	h := NewMemoryHistory(10, 5*time.Millisecond)
+
+	pos, _ := h.Append("RoomChannel/room_1", []byte("1"))
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := h.After("RoomChannel/room_1", StreamPosition{Epoch: h.epoch, Offset: 0}); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if entries, err := h.After("RoomChannel/room_1", pos); err != nil || len(entries) != 0 {
+		t.Errorf("Unexpected entries: %+v, %v", entries, err)
+	}
+
+	h.Append("RoomChannel/room_2", []byte("1"))
+
+	if _, ok := h.streams["RoomChannel/room_1"]; ok {
+		t.Error("The expired stream is not swept.")
+	}
+}
+
+func TestMemoryHistoryLimits(t *testing.T) {
+	for _, tc := range []struct {
+		size int
+		ttl  time.Duration
+	}{{-1, time.Minute}, {0, time.Minute}, {10, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("The invalid history is accepted: %d, %v", tc.size, tc.ttl)
+				}
+			}()
+
+			NewMemoryHistory(tc.size, tc.ttl)
+		}()
+	}
+}
+
+func TestReplayHistory(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	conn.protocol = &protocol{name: extJSONProtocol, codec: JSONCodec{}, extended: true}
+	cable := conn.cable
+	history := NewMemoryHistory(10, time.Minute)
+	cable.Config.WithHistory(history)
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(c *Channel) { c.StreamFrom("room_1") },
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	identifier := `{\"channel\":\"RoomChannel\"}`
+	ws.write([]byte(`{"command":"subscribe", "identifier":"` + identifier + `"}`))
+
+	for i := 1; i <= 3; i++ {
+		received := len(ws.messages())
+		cable.Broadcast("RoomChannel", "room_1", i)
+		ws.waitMessages(t, received+1)
+	}
+
+	cm, ok := ws.lastMessage().(channelMessage)
+
+	if !ok || cm.StreamID != "room_1" || cm.Epoch != history.epoch || cm.Offset != 3 {
+		t.Errorf("Unexpected message: %+v", ws.lastMessage())
+	}
+
+	received := len(ws.messages())
+	ws.write([]byte(`{"command":"history", "identifier":"` + identifier + `", "history":{"streams":{"room_1":{"epoch":"` + history.epoch + `","offset":1}}}}`))
+
+	replayed := ws.messages()[received:]
+
+	if len(replayed) != 3 {
+		t.Fatalf("Unexpected replayed messages: %+v", replayed)
+	}
+
+	for i, offset := range []uint64{2, 3} {
+		if cm, ok := replayed[i].(channelMessage); !ok || cm.Offset != offset || cm.Message != float64(offset) {
+			t.Errorf("Unexpected replayed message: %+v", replayed[i])
+		}
+	}
+
+	if m, ok := replayed[2].(map[string]string); !ok || m["type"] != "confirm_history" {
+		t.Errorf("Unexpected history confirmation: %+v", replayed[2])
+	}
+
+	received = len(ws.messages())
+	ws.write([]byte(`{"command":"history", "identifier":"` + identifier + `", "history":{"streams":{"room_1":{"epoch":"stale","offset":1}}}}`))
+
+	if m, ok := ws.messages()[received].(map[string]string); !ok || m["type"] != "reject_history" {
+		t.Errorf("Unexpected history rejection: %+v", ws.messages()[received])
+	}
+}
+
+func TestHoldBackLiveMessagesDuringReplay(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	conn.protocol = &protocol{name: extJSONProtocol, codec: JSONCodec{}, extended: true}
+
+	history := NewMemoryHistory(10, time.Minute)
+	conn.cable.Config.WithHistory(history)
+
+	go conn.serveWriting()
+	defer close(conn.done)
+
+	ch := newChannel(conn, `{"channel":"RoomChannel"}`, nil, &ChannelDescription{Name: "RoomChannel"}, nil)
+	ch.streams["room_1"] = struct{}{}
+
+	// The messages 2 and 3 arrive live while replaying, they are delivered once and in order.
+	ch.replaying = true
+
+	for i := 1; i <= 3; i++ {
+		data := []byte(fmt.Sprint(i))
+		pos, _ := history.Append(historyStream("RoomChannel", "room_1"), data)
+
+		if i == 1 {
+			continue
+		}
+
+		msg := newBroadcastMessage("RoomChannel", "room_1", data)
+		msg.position = pos
+
+		if !ch.holdBack(msg) {
+			t.Error("The live message is not held back.")
+		}
+	}
+
+	ch.replayHistory(&historyRequest{Streams: map[string]StreamPosition{"room_1": {Epoch: history.epoch, Offset: 0}}})
+	time.Sleep(5 * time.Millisecond)
+
+	offsets := []uint64{}
+	for _, m := range ws.messages() {
+		if cm, ok := m.(channelMessage); ok {
+			offsets = append(offsets, cm.Offset)
+		}
+	}
+
+	if fmt.Sprint(offsets) != "[1 2 3]" {
+		t.Errorf("Unexpected offsets: %v", offsets)
+	}
+
+	if ch.replaying {
+		t.Error("The channel is still replaying.")
+	}
+}
+
+// A PubSub whose subscriptions block until released.
+type blockingPubSub struct {
+	*SubscriberMap
+	release chan struct{}
+}
+
+func (p *blockingPubSub) Subscribe(c *Channel, broadcasting string) error {
+	<-p.release
+
+	return p.SubscriberMap.Subscribe(c, broadcasting)
+}
+
+// A history failing to read the stream.
+type failingHistory struct {
+	*MemoryHistory
+	stream string
+}
+
+func (h *failingHistory) After(stream string, pos StreamPosition) ([]HistoryEntry, error) {
+	if stream == h.stream {
+		return nil, errors.New("unavailable")
+	}
+
+	return h.MemoryHistory.After(stream, pos)
+}
+
+func TestReplayHistoryOfSubscribingStreams(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	conn.protocol = &protocol{name: extJSONProtocol, codec: JSONCodec{}, extended: true}
+
+	history := NewMemoryHistory(10, time.Minute)
+	conn.cable.Config.WithHistory(&failingHistory{MemoryHistory: history, stream: historyStream("RoomChannel", "room_2")})
+
+	go conn.serveWriting()
+	defer close(conn.done)
+
+	ch := newChannel(conn, `{"channel":"RoomChannel"}`, nil, &ChannelDescription{Name: "RoomChannel"}, nil)
+	pubsub := &blockingPubSub{SubscriberMap: &SubscriberMap{}, release: make(chan struct{})}
+	ch.pubsub = pubsub
+
+	for _, broadcasting := range []string{"room_1", "room_2"} {
+		history.Append(historyStream("RoomChannel", broadcasting), []byte(`"`+broadcasting+`"`))
+		ch.StreamFrom(broadcasting)
+	}
+
+	replayed := make(chan struct{})
+	go func() {
+		ch.replayHistory(&historyRequest{Streams: map[string]StreamPosition{
+			"room_1": {Epoch: history.epoch},
+			"room_2": {Epoch: history.epoch},
+		}})
+		close(replayed)
+	}()
+
+	// The replay waits for the streams being subscribed to.
+	select {
+	case <-replayed:
+		t.Fatal("The history is replayed before the streams are subscribed to.")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(pubsub.release)
+	<-replayed
+	ws.waitMessages(t, 3)
+
+	messages := ws.messages()
+
+	// The failed stream is skipped, but the history is rejected.
+	if cm, ok := messages[1].(channelMessage); !ok || cm.StreamID != "room_1" || cm.Message != "room_1" {
+		t.Errorf("Unexpected replayed message: %+v", messages[1])
+	}
+
+	if m, ok := messages[2].(map[string]string); !ok || m["type"] != "reject_history" {
+		t.Errorf("Unexpected history result: %+v", messages[2])
+	}
+}
+
+func TestRedisHistoryRequiresRedisPubSub(t *testing.T) {
+	// Either order of WithRedisHistory and WithRedisPubSub is fine.
+	cfg := NewConfig().WithRedisHistory(10, time.Minute).WithRedisPubSub(&redis.Options{})
+
+	if h, ok := cfg.history.(*RedisHistory); !ok || h.Size != 10 {
+		t.Errorf("Unexpected history: %+v", cfg.history)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("The Redis history is accepted without the Redis pubsub.")
+		}
+	}()
+
+	NewActionCable(NewConfig().WithRedisHistory(10, time.Minute))
+}
@@ -0,0 +1,97 @@
+package actioncable
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Multiple named identifiers of a connection, like `identified_by :current_user, :current_account` of Rails.
+// Return it from the authenticator, e.g. `actioncable.Identifiers{"current_user": "1", "current_account": "2"}`.
+type Identifiers map[string]string
+
+// The channel of the internal broadcastings, which the connections subscribe to for the remote commands.
+const internalChannelName = "action_cable"
+
+// The command sent to the internal broadcastings, e.g. by Cable.DisconnectRemoteConnection.
+type remoteCommand struct {
+	Type string `json:"type"`
+	// Only the connections with all the identifiers obey the command.
+	Identifiers Identifiers `json:"identifiers,omitempty"`
+	// Only the connection of the session obeys the command, e.g. evicted for the quotas.
+	Session string `json:"session,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Whether all the identifiers of the subset are the same.
+func (ids Identifiers) includes(subset Identifiers) bool {
+	for k, v := range subset {
+		if id, ok := ids[k]; !ok || id != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The keys in order.
+func (ids Identifiers) keys() []string {
+	keys := make([]string, 0, len(ids))
+	for k := range ids {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// The identifiers of the connection, nil if the authenticator doesn't return Identifiers.
+func (conn *Connection) Identifiers() Identifiers {
+	ids, _ := conn.identifier.(Identifiers)
+
+	return ids
+}
+
+// The identifiers of the connection, nil if the authenticator doesn't return Identifiers.
+func (c *Channel) Identifiers() Identifiers {
+	ids, _ := c.ConnIdentifier.(Identifiers)
+
+	return ids
+}
+
+// The connection identifier as a string. For Identifiers, it's the values ordered by their names and joined by
+// ":", like the `connection_identifier` of Rails.
+func connectionGID(identifier any) string {
+	ids, ok := identifier.(Identifiers)
+
+	if !ok {
+		return fmt.Sprintf("%v", identifier)
+	}
+
+	keys := ids.keys()
+	values := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, ids[k])
+	}
+
+	return strings.Join(values, ":")
+}
+
+// The internal broadcastings of the connection: the one named after all the identifiers (`action_cable/<gid>`),
+// and one per identifier (`action_cable/<name>=<value>`) to be targeted by the subsets.
+func internalBroadcastings(identifier any) []string {
+	broadcastings := []string{internalChannelName + "/" + connectionGID(identifier)}
+
+	if ids, ok := identifier.(Identifiers); ok {
+		for _, k := range ids.keys() {
+			broadcastings = append(broadcastings, fmt.Sprintf("%s/%s=%s", internalChannelName, k, ids[k]))
+		}
+	}
+
+	return broadcastings
+}
+
+// The internal broadcasting of a single connection, e.g. to evict it for the quotas.
+func sessionBroadcasting(sid string) string {
+	return internalChannelName + "/session:" + sid
+}
@@ -0,0 +1,115 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDisconnectRemoteConnectionsByIdentifiers(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	closed := make(chan any, 4)
+	cable.Config.WithOnDisconnect(func(c *Connection, r DisconnectReason) {
+		if r == DisconnectRemote {
+			closed <- c.Identifier()
+		}
+	})
+
+	newConnection := func(id any) *Connection {
+		conn, _ := newTestConnection(id)
+		conn.cable = cable
+		conn.Setup()
+
+		return conn
+	}
+
+	expect := func(ids ...string) {
+		t.Helper()
+
+		got := map[string]bool{}
+		for range ids {
+			select {
+			case id := <-closed:
+				got[connectionGID(id)] = true
+			case <-time.After(time.Second):
+				t.Fatalf("Expected %v to be disconnected, got %v", ids, got)
+			}
+		}
+
+		for _, id := range ids {
+			if !got[id] {
+				t.Errorf("Expected %s to be disconnected, got %v", id, got)
+			}
+		}
+
+		select {
+		case id := <-closed:
+			t.Errorf("Unexpected disconnection of %v", id)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	user1 := newConnection(Identifiers{"current_user": "1", "current_account": "a"})
+	newConnection(Identifiers{"current_user": "2", "current_account": "a"})
+	user3 := newConnection(Identifiers{"current_user": "3", "current_account": "b"})
+	legacy := newConnection("user4")
+	defer user3.Close("test complete")
+
+	if ids := user1.Identifiers(); ids["current_user"] != "1" || user1.internalChannel.Identifiers()["current_account"] != "a" {
+		t.Errorf("Unexpected identifiers: %v", ids)
+	}
+
+	if legacy.Identifiers() != nil {
+		t.Error("A plain identifier is not Identifiers.")
+	}
+
+	cable.DisconnectRemoteConnection(Identifiers{"current_user": "1", "current_account": "b"})
+	expect()
+
+	cable.DisconnectRemoteConnection(Identifiers{"current_account": "a"})
+	expect("a:1", "a:2")
+
+	cable.DisconnectRemoteConnection("user4")
+	expect("user4")
+}
+
+func TestConnectionGID(t *testing.T) {
+	for expected, id := range map[string]any{
+		"user1":   "user1",
+		"1":       1,
+		"1:admin": Identifiers{"role": "admin", "current_user": "1"},
+		"1:2":     Identifiers{"current_account": "1", "current_user": "2"},
+		"2:1":     Identifiers{"current_account": "2", "current_user": "1"},
+	} {
+		if gid := connectionGID(id); gid != expected {
+			t.Errorf("connectionGID(%v) = %s, expected %s", id, gid, expected)
+		}
+	}
+
+	broadcastings := internalBroadcastings(Identifiers{"user": "1", "account": "a"})
+	expected := []string{"action_cable/a:1", "action_cable/account=a", "action_cable/user=1"}
+
+	if len(broadcastings) != len(expected) {
+		t.Fatalf("Unexpected internal broadcastings: %v", broadcastings)
+	}
+
+	for i := range expected {
+		if broadcastings[i] != expected[i] {
+			t.Errorf("Unexpected internal broadcastings: %v", broadcastings)
+		}
+	}
+}
+
+func TestSessionIdentifiers(t *testing.T) {
+	b, _ := json.Marshal(&Session{Identifier: Identifiers{"user": "1"}, Identifiers: Identifiers{"user": "1"}})
+
+	var session Session
+	json.Unmarshal(b, &session)
+
+	if ids, ok := session.identifier().(Identifiers); !ok || ids["user"] != "1" {
+		t.Errorf("The identifiers are not restored: %#v", session.identifier())
+	}
+}
@@ -1,33 +1,54 @@
 package actioncable
 
-import "fmt"
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// The logger is installed once for all the tests, since the goroutines of the previous tests may still be logging.
+func TestMain(m *testing.M) {
+	logger = &testLogger{}
+
+	os.Exit(m.Run())
+}
 
 type testLogger struct {
-	debugMessages []string
 	infoMessages  []string
 	errorMessages []string
+	mu            sync.Mutex
 }
 
 var _ Logger = (*testLogger)(nil)
 
-func (l *testLogger) Debug(msg string) {
-	l.debugMessages = append(l.debugMessages, msg)
-}
+// The debug messages are not kept, there're too many of them in the benchmarks.
+func (l *testLogger) Debug(msg string) {}
 
 func (l *testLogger) Info(msg string) {
-	l.debugMessages = append(l.infoMessages, msg)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.infoMessages = append(l.infoMessages, msg)
 }
 
 func (l *testLogger) Error(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.errorMessages = append(l.errorMessages, msg)
 }
 
-func getCurrentTestLogger() *testLogger {
-	tl, ok := logger.(*testLogger)
+func (l *testLogger) lastError() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	if !ok {
-		panic(fmt.Sprintf("%v is not a testLogger", logger))
+	if len(l.errorMessages) == 0 {
+		return ""
 	}
 
-	return tl
+	return l.errorMessages[len(l.errorMessages)-1]
+}
+
+func getCurrentTestLogger() *testLogger {
+	return logger.(*testLogger)
 }
@@ -0,0 +1,342 @@
+package actioncable
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Returned by Cable.HandlePoll when the request is rejected.
+var ErrPollRejected = errors.New("actioncable: long-polling request rejected")
+
+var (
+	errPollClosed  = errors.New("actioncable: long-polling session is closed")
+	errPollExpired = errors.New("actioncable: long-polling session is expired")
+)
+
+var pollProtocol = &protocol{name: "actioncable-v1-long-polling", codec: JSONCodec{}}
+
+// The frames buffered per session. The oldest frames are dropped once the client falls behind further.
+const pollBufferSize = 1000
+
+// The long-polling transport. The frames are buffered until the client polls them, while the commands
+// are POSTed by the client.
+type pollConn struct {
+	frames   [][]byte
+	notify   chan struct{}
+	commands chan []byte
+	done     chan struct{}
+	closed   bool
+	expired  bool
+	lastSeen time.Time
+	mu       sync.Mutex
+}
+
+var _ IConn = (*pollConn)(nil)
+
+func newPollConn() *pollConn {
+	return &pollConn{
+		notify:   make(chan struct{}, 1),
+		commands: make(chan []byte),
+		done:     make(chan struct{}),
+		lastSeen: time.Now(),
+	}
+}
+
+func (c *pollConn) WriteJSON(v any) error {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return c.WriteMessage(pollProtocol.codec.FrameType(), b)
+}
+
+func (c *pollConn) WriteMessage(_ int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errPollClosed
+	}
+
+	if len(c.frames) == pollBufferSize {
+		logger.Error("Long-polling buffer is full, dropping the oldest frame.")
+		c.frames = c.frames[1:]
+	}
+
+	c.frames = append(c.frames, data)
+	c.signal()
+
+	return nil
+}
+
+func (c *pollConn) ReadMessage() (int, []byte, error) {
+	select {
+	case cmd := <-c.commands:
+		return pollProtocol.codec.FrameType(), cmd, nil
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.expired {
+			return 0, nil, errPollExpired
+		}
+
+		return 0, nil, errPollClosed
+	}
+}
+
+func (c *pollConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+		c.signal()
+	}
+
+	return nil
+}
+
+// Wake up the pending poll, if any. It's called holding c.mu.
+func (c *pollConn) signal() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Take the buffered frames, waiting for the timeout if there is none yet.
+// The second return value tells whether the session is closed and drained.
+func (c *pollConn) poll(ctx context.Context, timeout time.Duration) ([][]byte, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		c.lastSeen = time.Now()
+		frames, closed := c.frames, c.closed
+		c.frames = nil
+		c.mu.Unlock()
+
+		if len(frames) > 0 || closed {
+			return frames, closed
+		}
+
+		select {
+		case <-c.notify:
+		case <-timer.C:
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// Hand the commands over to the connection, in order.
+func (c *pollConn) push(ctx context.Context, commands [][]byte) error {
+	for _, cmd := range commands {
+		select {
+		case c.commands <- cmd:
+		case <-c.done:
+			return errPollClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Close the session abandoned by the client.
+func (c *pollConn) expire() {
+	c.mu.Lock()
+	c.expired = true
+	c.mu.Unlock()
+
+	c.Close()
+}
+
+func (c *pollConn) idle(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return now.Sub(c.lastSeen)
+}
+
+// The long-polling sessions of a cable, keyed by their tokens. Unlike the session IDs of the connections, the
+// tokens are only told to the clients opening the sessions, since they're the credentials of the sessions.
+type longPoller struct {
+	sessions map[string]*pollConn
+	stop     chan struct{}
+	mu       sync.Mutex
+}
+
+func (cb *Cable) longPoller() *longPoller {
+	cb.pollerOnce.Do(func() {
+		cb.poller = &longPoller{sessions: map[string]*pollConn{}, stop: make(chan struct{})}
+
+		go cb.poller.expireAbandonedSessions(cb.Config.pollSessionTimeout)
+	})
+
+	return cb.poller
+}
+
+func (p *longPoller) get(sid string) *pollConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.sessions[sid]
+}
+
+func (p *longPoller) remove(sid string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.sessions, sid)
+}
+
+// Close the sessions which are not polled for the timeout, the connections then go away as if the client
+// is gone. The closed sessions are forgotten as well.
+func (p *longPoller) expireAbandonedSessions(timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			for sid, c := range p.sessions {
+				if c.idle(now) > timeout {
+					logger.Debug("Long-polling session expired: " + sid)
+					c.expire()
+					delete(p.sessions, sid)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Handle the long-polling transport, for the clients which can't use WebSockets or Server-Sent Events.
+//   - POST without the `session` URL parameter opens a session, responding `{"session":"<id>"}`.
+//   - GET ?session=<id> responds a JSON array of the frames buffered for the session, waiting for the
+//     poll timeout if there is none yet. It responds 410 once the session is closed and drained.
+//   - POST ?session=<id> sends the commands (subscribe, unsubscribe, message) separated by newlines.
+//   - DELETE ?session=<id> closes the session.
+//
+// The sessions not polled for the session timeout are closed.
+func (cb *Cable) HandlePoll(w http.ResponseWriter, r *http.Request) error {
+	p := cb.longPoller()
+	sid := r.URL.Query().Get("session")
+
+	if sid == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "session required", http.StatusBadRequest)
+
+			return fmt.Errorf("%w: session required", ErrPollRejected)
+		}
+
+		return cb.openPollSession(w, r)
+	}
+
+	c := p.get(sid)
+
+	if c == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+
+		return fmt.Errorf("%w: session not found", ErrPollRejected)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		frames, closed := c.poll(r.Context(), cb.Config.pollTimeout)
+
+		if closed && len(frames) == 0 {
+			p.remove(sid)
+			http.Error(w, "session closed", http.StatusGone)
+
+			return nil
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(append(append([]byte("["), bytes.Join(frames, []byte(","))...), ']'))
+	case http.MethodPost:
+		commands, err := readCommands(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return fmt.Errorf("%w: %v", ErrPollRejected, err)
+		}
+
+		if err := c.push(r.Context(), commands); err != nil {
+			http.Error(w, "session closed", http.StatusGone)
+
+			return nil
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		c.Close()
+		p.remove(sid)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	return nil
+}
+
+func (cb *Cable) openPollSession(w http.ResponseWriter, r *http.Request) error {
+	cfg := cb.Config
+
+	if !checkOrigin(cfg.allowedOrigins)(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+
+		return fmt.Errorf("%w: origin not allowed", ErrPollRejected)
+	}
+
+	id, pass := cfg.authenticator(r)
+
+	if !pass {
+		logger.Info("An unauthorized connection attempt was rejected.")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		cb.notifyUnauthorized(nil, pollProtocol)
+
+		return fmt.Errorf("%w: unauthorized", ErrPollRejected)
+	}
+
+	transport := newPollConn()
+	_, err := cb.connect(id, transport, pollProtocol, nil)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+
+		return fmt.Errorf("%w: %v", ErrPollRejected, err)
+	}
+
+	token := randomToken()
+	p := cb.longPoller()
+	p.mu.Lock()
+	p.sessions[token] = transport
+	p.mu.Unlock()
+
+	logger.Info("Successfully opened a long-polling session.")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	return json.NewEncoder(w).Encode(map[string]string{"session": token})
+}
@@ -0,0 +1,199 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPollClient struct {
+	t       *testing.T
+	url     string
+	session string
+}
+
+func (c *testPollClient) open() {
+	resp, err := http.Post(c.url, "application/json", nil)
+
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	m := map[string]string{}
+	json.NewDecoder(resp.Body).Decode(&m)
+
+	if resp.StatusCode != http.StatusCreated || m["session"] == "" {
+		c.t.Fatalf("Can't open a session: %d, %+v", resp.StatusCode, m)
+	}
+
+	c.session = m["session"]
+}
+
+func (c *testPollClient) poll() ([]map[string]any, int) {
+	resp, err := http.Get(c.url + "?session=" + c.session)
+
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	frames := []map[string]any{}
+	json.NewDecoder(resp.Body).Decode(&frames)
+
+	return frames, resp.StatusCode
+}
+
+func (c *testPollClient) send(commands string) int {
+	resp, err := http.Post(c.url+"?session="+c.session, "application/x-ndjson", strings.NewReader(commands))
+
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func newTestPollServer(t *testing.T, cable *Cable) (*httptest.Server, *testPollClient) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cable.HandlePoll(w, r)
+	}))
+
+	return server, &testPollClient{t: t, url: server.URL}
+}
+
+func TestHandlePoll(t *testing.T) {
+	cable := newTestCable()
+	cable.Config.WithLongPolling(20*time.Millisecond, time.Minute)
+	cable.PubSub.Run()
+	defer cable.Stop()
+
+	events := make(chan string, 2)
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			events <- "subscribed"
+			c.StreamFrom("room_1")
+		},
+		Unsubscribed: func(c *Channel) { events <- "unsubscribed" },
+	})
+
+	server, client := newTestPollServer(t, cable)
+	defer server.Close()
+
+	client.open()
+
+	if frames, _ := client.poll(); len(frames) != 1 || frames[0]["type"] != "welcome" || frames[0]["sid"] == "" || frames[0]["sid"] == client.session {
+		t.Errorf("Unexpected frames: %+v", frames)
+	}
+
+	if frames, status := client.poll(); status != http.StatusOK || len(frames) != 0 {
+		t.Errorf("Unexpected frames: %d, %+v", status, frames)
+	}
+
+	if status := client.send(`{"command":"subscribe","identifier":"{\"channel\":\"RoomChannel\"}"}`); status != http.StatusAccepted {
+		t.Errorf("Unexpected status: %d", status)
+	}
+
+	if <-events != "subscribed" {
+		t.Error("The Subscribed callback is not called.")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	cable.Broadcast("RoomChannel", "room_1", "hello")
+	time.Sleep(5 * time.Millisecond)
+
+	frames, _ := client.poll()
+
+	if len(frames) != 2 || frames[0]["type"] != "confirm_subscription" || frames[1]["message"] != "hello" {
+		t.Errorf("Unexpected frames: %+v", frames)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, client.url+"?session="+client.session, nil)
+	resp, _ := http.DefaultClient.Do(req)
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Unexpected status: %d", resp.StatusCode)
+	}
+
+	select {
+	case e := <-events:
+		if e != "unsubscribed" {
+			t.Errorf("Unexpected event: %s", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("The Unsubscribed callback is not called.")
+	}
+
+	if _, status := client.poll(); status != http.StatusNotFound {
+		t.Errorf("Unexpected status: %d", status)
+	}
+}
+
+func TestHandlePollExpiresAbandonedSessions(t *testing.T) {
+	cable := newTestCable()
+	cable.Config.WithLongPolling(10*time.Millisecond, 20*time.Millisecond).
+		WithSessionRestoration(time.Minute).WithSessionStore(NewMemorySessionStore())
+
+	reasons := make(chan DisconnectReason, 1)
+	cable.Config.WithOnDisconnect(func(_ *Connection, r DisconnectReason) { reasons <- r })
+
+	cable.PubSub.Run()
+	defer cable.Stop()
+
+	server, client := newTestPollServer(t, cable)
+	defer server.Close()
+
+	client.open()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, status := client.poll(); status != http.StatusNotFound {
+		t.Errorf("Unexpected status: %d", status)
+	}
+
+	// The abandoned session is not kept for the restoration.
+	select {
+	case r := <-reasons:
+		if r != DisconnectPollExpired || r.restorable() {
+			t.Errorf("Unexpected reason: %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Error("OnDisconnect is not called.")
+	}
+
+	// Stopping the cable again does nothing.
+	cable.Stop()
+}
+
+func TestHandlePollRequiresSession(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.Stop()
+
+	w := httptest.NewRecorder()
+
+	if err := cable.HandlePoll(w, httptest.NewRequest(http.MethodGet, "/cable", nil)); err == nil || w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected response: %d, %v", w.Code, err)
+	}
+
+	w = httptest.NewRecorder()
+
+	if err := cable.HandlePoll(w, httptest.NewRequest(http.MethodGet, "/cable?session=unknown", nil)); err == nil || w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected response: %d, %v", w.Code, err)
+	}
+}
+
+func TestLongPollingTimeouts(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("The zero session timeout is accepted.")
+		}
+	}()
+
+	NewConfig().WithLongPolling(time.Second, 0)
+}
@@ -4,7 +4,15 @@ import (
 	"time"
 )
 
-var welcomeMessage = map[string]string{"type": "welcome"}
+type welcomeMessage struct {
+	Type string `json:"type"`
+	// The session ID of the connection.
+	Sid string `json:"sid,omitempty"`
+	// The token to present when reconnecting to restore the session.
+	RestoreToken string   `json:"restore_token,omitempty"`
+	Restored     bool     `json:"restored,omitempty"`
+	RestoredIDs  []string `json:"restored_ids,omitempty"`
+}
 
 type disconnectMessage struct {
 	Type      string `json:"type"`
@@ -21,11 +29,24 @@ type command struct {
 	Identifier string `json:"identifier"`
 	Command    string `json:"command"`
 	Data       string `json:"data"`
+	// Only for the history command of the extended protocols.
+	History *historyRequest `json:"history,omitempty"`
+}
+
+// The client asks for the messages missed since the given positions of the streams. For the streams not listed,
+// the messages published since the `since` unix timestamp are replayed.
+type historyRequest struct {
+	Since   int64                     `json:"since"`
+	Streams map[string]StreamPosition `json:"streams"`
 }
 
 type channelMessage struct {
 	Identifier string `json:"identifier"`
 	Message    any    `json:"message"`
+	// The stream position of the message, only for the extended protocols.
+	StreamID string `json:"stream_id,omitempty"`
+	Epoch    string `json:"epoch,omitempty"`
+	Offset   uint64 `json:"offset,omitempty"`
 }
 
 func newPingMessage() *pingMessage {
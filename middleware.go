@@ -0,0 +1,99 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Returned by the middlewares rejecting a command, see CommandMiddleware.
+var ErrCommandRejected = errors.New("actioncable: command rejected")
+
+// A command received from a client, passed through the command middlewares.
+type Command struct {
+	// subscribe, unsubscribe, message, history or whisper.
+	Command string
+	// E.g. `{"channel":"RoomChannel","id":1}`
+	Identifier string
+	// The channel name of the identifier, e.g. RoomChannel.
+	Channel string
+	// The payload of the message and whisper commands, e.g. `{"action":"speak","message":"Hi"}`.
+	Data    string
+	history *historyRequest
+}
+
+// Execute a command of the connection.
+type CommandHandler func(conn *Connection, cmd *Command) error
+
+// Wrap the handler executing the commands. A middleware could inspect or modify the command before calling next,
+// reject it by returning an error (e.g. ErrCommandRejected) without calling next, or short-circuit it by returning
+// nil without calling next. The rejected subscribe commands are told `reject_subscription`.
+type CommandMiddleware func(next CommandHandler) CommandHandler
+
+// Log the commands along with the connection identifiers and their errors.
+func LogCommands() CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(conn *Connection, cmd *Command) error {
+			err := next(conn, cmd)
+
+			if err != nil {
+				logger.Error(fmt.Sprintf("Command %s of %s from %v failed: %v", cmd.Command, cmd.Identifier, conn.identifier, err))
+			} else {
+				logger.Info(fmt.Sprintf("Command %s of %s from %v", cmd.Command, cmd.Identifier, conn.identifier))
+			}
+
+			return err
+		}
+	}
+}
+
+// Report how long the commands take to the function, e.g. to record the metrics. They are logged if it's nil.
+func TimeCommands(report func(conn *Connection, cmd *Command, elapsed time.Duration)) CommandMiddleware {
+	if report == nil {
+		report = func(conn *Connection, cmd *Command, elapsed time.Duration) {
+			logger.Info(fmt.Sprintf("Command %s of %s took %v", cmd.Command, cmd.Identifier, elapsed))
+		}
+	}
+
+	return func(next CommandHandler) CommandHandler {
+		return func(conn *Connection, cmd *Command) error {
+			start := time.Now()
+			err := next(conn, cmd)
+			report(conn, cmd, time.Since(start))
+
+			return err
+		}
+	}
+}
+
+// Chain the middlewares around the handler, the first one is the outermost.
+func chainCommandMiddlewares(handler CommandHandler, middlewares []CommandMiddleware) CommandHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// Execute the command after the middlewares.
+func dispatchCommand(conn *Connection, cmd *Command) error {
+	switch cmd.Command {
+	case "subscribe":
+		conn.addSubscription(cmd.Channel, cmd.Identifier, json.RawMessage(cmd.Identifier))
+	case "unsubscribe":
+		conn.removeSubscription(cmd.Channel, cmd.Identifier)
+	case "message":
+		conn.performAction(cmd.Channel, cmd.Identifier, cmd.Data)
+	case "history":
+		conn.replayHistory(cmd.Channel, cmd.Identifier, cmd.history)
+	case "whisper":
+		conn.whisper(cmd.Channel, cmd.Identifier, cmd.Data)
+	default:
+		logger.Error(fmt.Sprintf("Received unrecognized command %+v", cmd))
+
+		return fmt.Errorf("received unrecognized command %+v", cmd)
+	}
+
+	return nil
+}
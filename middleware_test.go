@@ -0,0 +1,93 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandMiddleware(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+	calls := []string{}
+	timed := 0
+	messages := []string{}
+
+	trace := func(name string) CommandMiddleware {
+		return func(next CommandHandler) CommandHandler {
+			return func(conn *Connection, cmd *Command) error {
+				calls = append(calls, name+" "+cmd.Command)
+
+				return next(conn, cmd)
+			}
+		}
+	}
+
+	cable.Config.WithCommandMiddleware(trace("outer"), trace("inner")).WithCommandMiddleware(
+		// Per-tenant policy.
+		func(next CommandHandler) CommandHandler {
+			return func(conn *Connection, cmd *Command) error {
+				if cmd.Channel == "AdminChannel" {
+					return ErrCommandRejected
+				}
+
+				// Short-circuit the pings, modify the rest.
+				if cmd.Command == "message" {
+					if strings.Contains(cmd.Data, "ping") {
+						return nil
+					}
+
+					cmd.Data = strings.Replace(cmd.Data, "hello", "HELLO", 1)
+				}
+
+				return next(conn, cmd)
+			}
+		},
+		TimeCommands(func(conn *Connection, cmd *Command, elapsed time.Duration) { timed++ }),
+		LogCommands(),
+	)
+
+	for _, name := range []string{"RoomChannel", "AdminChannel"} {
+		cable.RegisterChannel(&ChannelDescription{
+			Name: name,
+			Actions: map[string]ChannelActionCallback{
+				"speak": func(c *Channel, data json.RawMessage) { messages = append(messages, string(data)) },
+			},
+		})
+	}
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	ws.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"action\":\"speak\",\"message\":\"hello\"}"}`))
+	ws.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"action\":\"speak\",\"message\":\"ping\"}"}`))
+
+	sent := len(ws.messages())
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"AdminChannel\"}"}`))
+
+	if len(calls) != 8 || calls[0] != "outer subscribe" || calls[1] != "inner subscribe" || calls[2] != "outer message" {
+		t.Errorf("Unexpected calls: %v", calls)
+	}
+
+	if len(messages) != 1 || messages[0] != `{"message":"HELLO"}` {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+
+	if timed != 2 {
+		t.Errorf("Expected 2 commands timed, got %d", timed)
+	}
+
+	if len(ws.messages()) != sent+1 {
+		t.Fatalf("Unexpected messages: %+v", ws.messages()[sent:])
+	}
+
+	if m, ok := ws.messages()[sent].(map[string]string); !ok || m["type"] != "reject_subscription" || m["identifier"] != `{"channel":"AdminChannel"}` {
+		t.Errorf("Unexpected message: %+v", ws.messages()[sent])
+	}
+
+	if len(conn.channels["AdminChannel"]) != 0 {
+		t.Error("The rejected subscription is subscribed.")
+	}
+}
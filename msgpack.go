@@ -0,0 +1,56 @@
+package actioncable
+
+import (
+	"bytes"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec for actioncable-v1-msgpack. The frames share the structure of the JSON ones,
+// so the msgpack encoder/decoder reuses the `json` struct tags.
+type MsgpackCodec struct{}
+
+var (
+	_ Codec          = MsgpackCodec{}
+	_ PayloadEncoder = MsgpackCodec{}
+)
+
+func (MsgpackCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpackMarshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpackUnmarshal(data, v)
+}
+
+func (MsgpackCodec) EncodePayload(payload any) (any, error) {
+	b, err := msgpackMarshal(payload)
+
+	return msgpack.RawMessage(b), err
+}
+
+func msgpackMarshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func msgpackUnmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	return dec.Decode(v)
+}
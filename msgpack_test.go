@@ -0,0 +1,97 @@
+package actioncable
+
+import (
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func decodeMsgpackFrame(t *testing.T, frame any) map[string]any {
+	b, ok := frame.([]byte)
+
+	if !ok {
+		t.Fatalf("Unexpected frame: %+v", frame)
+	}
+
+	m := map[string]any{}
+
+	if err := msgpackUnmarshal(b, &m); err != nil {
+		t.Fatalf("Can't decode msgpack frame: %v", err)
+	}
+
+	return m
+}
+
+func TestMsgpackConnection(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	conn.protocol = &protocol{name: msgpackProtocol, codec: MsgpackCodec{}}
+	cable := conn.cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(c *Channel) { c.StreamFrom("room_1") },
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+	ws.waitMessages(t, 1)
+
+	if m := decodeMsgpackFrame(t, ws.messages()[0]); m["type"] != "welcome" {
+		t.Errorf("Unexpected welcome message: %+v", m)
+	}
+
+	cmd, _ := msgpackMarshal(&command{Command: "subscribe", Identifier: `{"channel":"RoomChannel"}`})
+	ws.write(cmd)
+
+	if m := decodeMsgpackFrame(t, ws.lastMessage()); m["type"] != "confirm_subscription" {
+		t.Errorf("Unexpected confirm message: %+v", m)
+	}
+
+	received := len(ws.messages())
+	cable.Broadcast("RoomChannel", "room_1", map[string]string{"hello": "actioncable"})
+	ws.waitMessages(t, received+1)
+
+	m := decodeMsgpackFrame(t, ws.lastMessage())
+
+	if m["identifier"] != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected identifier: %+v", m)
+	}
+
+	if msg, ok := m["message"].(map[string]any); !ok || msg["hello"] != "actioncable" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
+
+func TestBroadcastMessageTranscodedOnce(t *testing.T) {
+	msg := newBroadcastMessage("RoomChannel", "room_1", []byte(`{"hello":"actioncable"}`))
+	mp := &protocol{name: msgpackProtocol, codec: MsgpackCodec{}}
+
+	p1, err := msg.payload(mp)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p2, _ := msg.payload(mp)
+	b1, _ := p1.(msgpack.RawMessage)
+	b2, _ := p2.(msgpack.RawMessage)
+
+	if len(b1) == 0 || &b1[0] != &b2[0] {
+		t.Error("The payload is transcoded more than once.")
+	}
+
+	decoded := map[string]any{}
+
+	if err := msgpackUnmarshal(b1, &decoded); err != nil || decoded["hello"] != "actioncable" {
+		t.Errorf("Unexpected msgpack payload: %v", b1)
+	}
+
+	p, _ := msg.payload(&protocol{name: jsonProtocol, codec: JSONCodec{}})
+
+	if m, ok := p.(map[string]any); !ok || m["hello"] != "actioncable" {
+		t.Errorf("Unexpected json payload: %+v", p)
+	}
+}
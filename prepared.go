@@ -0,0 +1,82 @@
+package actioncable
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// The extension of IConn writing the frames encoded once for all the subscribers of a broadcast, so the encoding
+// (and the compression) isn't repeated per connection. *websocket.Conn implements it.
+type PreparedConn interface {
+	IConn
+	WritePreparedMessage(pm *websocket.PreparedMessage) error
+}
+
+var _ PreparedConn = (*websocket.Conn)(nil)
+
+// A channel message of a broadcast, shared by the subscribers with the same identifier and protocol.
+type preparedFrame struct {
+	message      channelMessage
+	codec        Codec
+	broadcasting string
+
+	once     sync.Once
+	data     []byte
+	prepared *websocket.PreparedMessage
+	err      error
+}
+
+// The frame of the channel message for the connections speaking the protocol.
+func (m *broadcastMessage) frame(p *protocol, message channelMessage) *preparedFrame {
+	key := p.name + "/" + message.Identifier
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.frames == nil {
+		m.frames = map[string]*preparedFrame{}
+	}
+
+	f, ok := m.frames[key]
+
+	if !ok {
+		f = &preparedFrame{message: message, codec: p.codec, broadcasting: m.broadcasting}
+		m.frames[key] = f
+	}
+
+	return f
+}
+
+// Encode the message once.
+func (f *preparedFrame) prepare() error {
+	f.once.Do(func() {
+		f.data, f.err = f.codec.Marshal(f.message)
+
+		if f.err == nil {
+			f.prepared, f.err = websocket.NewPreparedMessage(f.codec.FrameType(), f.data)
+		}
+	})
+
+	return f.err
+}
+
+// Write the frame to the transport. The transports which are not PreparedConn are written the encoded bytes, but
+// the codecs writing the frames by themselves (i.e. JSON) write the message as usual.
+func (f *preparedFrame) write(wsConn IConn) error {
+	pc, ok := wsConn.(PreparedConn)
+
+	if _, isFrameWriter := f.codec.(frameWriter); !ok && isFrameWriter {
+		return writeMessage(wsConn, f.codec, f.message)
+	}
+
+	if err := f.prepare(); err != nil {
+		return err
+	}
+
+	if ok {
+		return pc.WritePreparedMessage(f.prepared)
+	}
+
+	return wsConn.WriteMessage(f.codec.FrameType(), f.data)
+}
@@ -0,0 +1,198 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+type preparedWsConnection struct {
+	*testWsConnection
+	prepared []*websocket.PreparedMessage
+}
+
+func (c *preparedWsConnection) WritePreparedMessage(pm *websocket.PreparedMessage) error {
+	c.prepared = append(c.prepared, pm)
+
+	return nil
+}
+
+func TestPreparedFrames(t *testing.T) {
+	json := &protocol{name: jsonProtocol, codec: JSONCodec{}}
+	msgpack := &protocol{name: msgpackProtocol, codec: MsgpackCodec{}}
+	msg := newBroadcastMessage("RoomChannel", "room_1", []byte(`{"hello":"actioncable"}`))
+	payload, _ := msg.payload(json)
+	m := channelMessage{Identifier: `{"channel":"RoomChannel"}`, Message: payload}
+
+	f := msg.frame(json, m)
+
+	if msg.frame(json, m) != f {
+		t.Error("The frame isn't shared by the subscribers with the same identifier.")
+	}
+
+	if msg.frame(msgpack, m) == f || msg.frame(json, channelMessage{Identifier: `{"channel":"RoomChannel","id":1}`}) == f {
+		t.Error("The frame is shared by the other protocol or identifier.")
+	}
+
+	ws := &preparedWsConnection{testWsConnection: &testWsConnection{}}
+	f.write(ws)
+	f.write(ws)
+
+	if len(ws.prepared) != 2 || ws.prepared[0] != ws.prepared[1] || string(f.data) != `{"identifier":"{\"channel\":\"RoomChannel\"}","message":{"hello":"actioncable"}}` {
+		t.Errorf("Unexpected prepared frames: %+v, %s", ws.prepared, f.data)
+	}
+
+	// The transports which don't support the prepared frames.
+	plain := &testWsConnection{}
+	f.write(plain)
+	msg.frame(msgpack, m).write(plain)
+
+	if len(plain.messages()) != 2 {
+		t.Fatalf("Unexpected messages: %+v", plain.messages())
+	}
+
+	if cm, ok := plain.messages()[0].(channelMessage); !ok || cm.Identifier != m.Identifier {
+		t.Errorf("Unexpected JSON message: %+v", plain.messages()[0])
+	}
+
+	if frame := decodeMsgpackFrame(t, plain.messages()[1]); frame["identifier"] != m.Identifier {
+		t.Errorf("Unexpected msgpack frame: %+v", frame)
+	}
+}
+
+func TestBroadcastPreparedFrames(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(c *Channel) { c.StreamFrom("room_1") },
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cable.Handle(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dialer := &websocket.Dialer{Subprotocols: []string{jsonProtocol}, EnableCompression: true}
+	clients := []*websocket.Conn{}
+
+	for i := 0; i < 2; i++ {
+		ws, _, err := dialer.Dial(url, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		ws.ReadJSON(&map[string]any{}) // welcome
+		ws.WriteJSON(&command{Command: "subscribe", Identifier: `{"channel":"RoomChannel"}`})
+		ws.ReadJSON(&map[string]any{}) // confirmation
+
+		clients = append(clients, ws)
+	}
+
+	cable.Broadcast("RoomChannel", "room_1", map[string]string{"hello": "actioncable"})
+
+	for _, ws := range clients {
+		_, frame, err := ws.ReadMessage()
+
+		if err != nil || string(frame) != `{"identifier":"{\"channel\":\"RoomChannel\"}","message":{"hello":"actioncable"}}` {
+			t.Errorf("Unexpected frame: %s, %v", frame, err)
+		}
+	}
+}
+
+// The server side of the compressed WebSocket connections whose clients discard what they read.
+func benchmarkConnections(b *testing.B, n int) []*websocket.Conn {
+	conns := make(chan *websocket.Conn, n)
+	upgrader := &websocket.Upgrader{EnableCompression: true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			b.Error(err)
+
+			return
+		}
+
+		conns <- conn
+	}))
+	b.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dialer := &websocket.Dialer{EnableCompression: true}
+	servers := make([]*websocket.Conn, 0, n)
+
+	for i := 0; i < n; i++ {
+		client, _, err := dialer.Dial(url, nil)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { client.Close() })
+
+		go func() {
+			for {
+				_, r, err := client.NextReader()
+
+				if err != nil {
+					return
+				}
+
+				io.Copy(io.Discard, r)
+			}
+		}()
+
+		servers = append(servers, <-conns)
+	}
+
+	return servers
+}
+
+// Broadcasting a message to the subscribers, encoding it per connection vs once for all of them.
+func BenchmarkBroadcastFanOut(b *testing.B) {
+	conns := benchmarkConnections(b, 100)
+	p := &protocol{name: jsonProtocol, codec: JSONCodec{}}
+	data := fmt.Sprintf(`{"action":"update","body":%q}`, strings.Repeat("actioncable ", 100))
+
+	// Every subscriber decodes and encodes the message by itself.
+	b.Run("per connection", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, conn := range conns {
+				var payload any
+
+				if err := json.Unmarshal([]byte(data), &payload); err != nil {
+					b.Fatal(err)
+				}
+
+				if err := writeMessage(conn, p.codec, channelMessage{Identifier: `{"channel":"RoomChannel"}`, Message: payload}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("prepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			msg := newBroadcastMessage("RoomChannel", "room_1", []byte(data))
+
+			for _, conn := range conns {
+				payload, _ := msg.payload(p)
+
+				if err := msg.frame(p, channelMessage{Identifier: `{"channel":"RoomChannel"}`, Message: payload}).write(conn); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
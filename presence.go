@@ -0,0 +1,405 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Returned by Channel.JoinPresence when the presence tracking is not enabled.
+var ErrPresenceDisabled = errors.New("actioncable: presence tracking is not enabled")
+
+// A member present in a stream. The ID is the connection identifier, so a member connected from several
+// tabs (sessions) is present once.
+type PresenceMember struct {
+	ID   string          `json:"id"`
+	Info json.RawMessage `json:"info,omitempty"`
+}
+
+// The presence sets of the streams. A member is present as long as one of its sessions is, the sessions
+// expire after the TTL unless they are touched by the heartbeat of the node they're on.
+type PresenceStore interface {
+	// Add the session of the member to the stream. It returns true if the member wasn't present yet.
+	Join(stream, session string, member PresenceMember, ttl time.Duration) (bool, error)
+	// Remove the session from the stream. It returns true if the member has no sessions left.
+	Leave(stream, session string) (PresenceMember, bool, error)
+	// Keep the sessions alive for another TTL and remove the expired ones of the stream, returning the members
+	// which have no sessions left.
+	Touch(stream string, sessions []string, ttl time.Duration) ([]PresenceMember, error)
+	// The members present in the stream, ordered by their IDs.
+	Members(stream string) ([]PresenceMember, error)
+}
+
+// The event broadcast to the subscribers of a stream when a member joins or leaves.
+type presenceEvent struct {
+	Type  string          `json:"type"`
+	Event string          `json:"event"`
+	ID    string          `json:"id"`
+	Info  json.RawMessage `json:"info,omitempty"`
+}
+
+// A PresenceStore in the process memory. It only suits the applications running on a single node.
+type MemoryPresence struct {
+	streams map[string]map[string]*memoryPresenceSession
+	mu      sync.Mutex
+}
+
+type memoryPresenceSession struct {
+	member    PresenceMember
+	expiresAt time.Time
+}
+
+var _ PresenceStore = (*MemoryPresence)(nil)
+
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{streams: map[string]map[string]*memoryPresenceSession{}}
+}
+
+func (p *MemoryPresence) Join(stream, session string, member PresenceMember, ttl time.Duration) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	present := p.present(stream, member.ID, now)
+
+	if p.streams[stream] == nil {
+		p.streams[stream] = map[string]*memoryPresenceSession{}
+	}
+
+	p.streams[stream][session] = &memoryPresenceSession{member: member, expiresAt: now.Add(ttl)}
+
+	return !present, nil
+}
+
+func (p *MemoryPresence) Leave(stream, session string) (PresenceMember, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.streams[stream][session]
+
+	if !ok {
+		return PresenceMember{}, false, nil
+	}
+
+	p.remove(stream, session)
+
+	return s.member, !p.present(stream, s.member.ID, time.Now()), nil
+}
+
+func (p *MemoryPresence) Touch(stream string, sessions []string, ttl time.Duration) ([]PresenceMember, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	for _, session := range sessions {
+		if s, ok := p.streams[stream][session]; ok {
+			s.expiresAt = now.Add(ttl)
+		}
+	}
+
+	expired := []PresenceMember{}
+
+	for session, s := range p.streams[stream] {
+		if now.After(s.expiresAt) {
+			p.remove(stream, session)
+			expired = append(expired, s.member)
+		}
+	}
+
+	return gonePresenceMembers(expired, p.present, stream, now), nil
+}
+
+func (p *MemoryPresence) Members(stream string) ([]PresenceMember, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	members := []PresenceMember{}
+
+	for _, s := range p.streams[stream] {
+		if !now.After(s.expiresAt) {
+			members = append(members, s.member)
+		}
+	}
+
+	return uniquePresenceMembers(members), nil
+}
+
+// Whether the member has an alive session in the stream. It's called holding p.mu.
+func (p *MemoryPresence) present(stream, id string, now time.Time) bool {
+	for _, s := range p.streams[stream] {
+		if s.member.ID == id && !now.After(s.expiresAt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *MemoryPresence) remove(stream, session string) {
+	delete(p.streams[stream], session)
+
+	if len(p.streams[stream]) == 0 {
+		delete(p.streams, stream)
+	}
+}
+
+// The members of the expired sessions which have no alive session left, once each.
+func gonePresenceMembers(expired []PresenceMember, present func(stream, id string, now time.Time) bool, stream string, now time.Time) []PresenceMember {
+	gone := []PresenceMember{}
+
+	for _, m := range uniquePresenceMembers(expired) {
+		if !present(stream, m.ID, now) {
+			gone = append(gone, m)
+		}
+	}
+
+	return gone
+}
+
+// Deduplicate the members by their IDs, ordered by the IDs.
+func uniquePresenceMembers(members []PresenceMember) []PresenceMember {
+	seen := map[string]bool{}
+	unique := []PresenceMember{}
+
+	for _, m := range members {
+		if !seen[m.ID] {
+			seen[m.ID] = true
+			unique = append(unique, m)
+		}
+	}
+
+	sort.Slice(unique, func(i, j int) bool { return unique[i].ID < unique[j].ID })
+
+	return unique
+}
+
+// The presence sessions joined on this node, which are kept alive by its heartbeat.
+type presenceTracker struct {
+	// stream -> the sessions joined on this node.
+	sessions map[string]map[string]struct{}
+	// stream -> the broadcasting of the channel the events are sent to. The streams are swept by the heartbeat
+	// until they have no members left, even after the sessions of this node left them, so the members of the
+	// other nodes (e.g. crashed) still expire.
+	streams map[string]presenceTarget
+	stop    chan struct{}
+	mu      sync.Mutex
+}
+
+type presenceTarget struct {
+	channelName  string
+	broadcasting string
+}
+
+func (cb *Cable) presenceTracker() *presenceTracker {
+	cb.presenceOnce.Do(func() {
+		cb.presence = &presenceTracker{
+			sessions: map[string]map[string]struct{}{},
+			streams:  map[string]presenceTarget{},
+			stop:     make(chan struct{}),
+		}
+
+		go cb.heartbeatPresence(cb.presence)
+	})
+
+	return cb.presence
+}
+
+// The members present in the broadcasting of the channel.
+func (cb *Cable) PresenceMembers(channelName, broadcasting string) ([]PresenceMember, error) {
+	store := cb.Config.presence
+
+	if store == nil {
+		return nil, ErrPresenceDisabled
+	}
+
+	return store.Members(historyStream(channelName, broadcasting))
+}
+
+func (cb *Cable) joinPresence(target presenceTarget, session string, member PresenceMember) error {
+	store := cb.Config.presence
+	stream := historyStream(target.channelName, target.broadcasting)
+	t := cb.presenceTracker()
+
+	joined, err := store.Join(stream, session, member, cb.Config.presenceTTL)
+
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	if t.sessions[stream] == nil {
+		t.sessions[stream] = map[string]struct{}{}
+	}
+	t.sessions[stream][session] = struct{}{}
+	t.streams[stream] = target
+	t.mu.Unlock()
+
+	if joined {
+		cb.publishPresence(target, "join", member)
+	}
+
+	return nil
+}
+
+func (cb *Cable) leavePresence(target presenceTarget, session string) error {
+	store := cb.Config.presence
+	stream := historyStream(target.channelName, target.broadcasting)
+	t := cb.presenceTracker()
+
+	t.mu.Lock()
+	delete(t.sessions[stream], session)
+	if len(t.sessions[stream]) == 0 {
+		delete(t.sessions, stream)
+	}
+	t.mu.Unlock()
+
+	member, left, err := store.Leave(stream, session)
+
+	if err != nil {
+		return err
+	}
+
+	if left {
+		cb.publishPresence(target, "leave", member)
+	}
+
+	return nil
+}
+
+// Touch the sessions of this node once per a third of the TTL, announcing the members gone with the expired
+// sessions (e.g. of the crashed nodes) of the tracked streams.
+func (cb *Cable) heartbeatPresence(t *presenceTracker) {
+	ttl := cb.Config.presenceTTL
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			streams := make(map[string]presenceTarget, len(t.streams))
+			sessions := make(map[string][]string, len(t.sessions))
+			for stream, target := range t.streams {
+				streams[stream] = target
+				for session := range t.sessions[stream] {
+					sessions[stream] = append(sessions[stream], session)
+				}
+			}
+			t.mu.Unlock()
+
+			for stream, target := range streams {
+				cb.sweepPresence(t, stream, target, sessions[stream])
+			}
+		}
+	}
+}
+
+// Touch the sessions of this node in the stream, and stop tracking the stream once it has no members left.
+func (cb *Cable) sweepPresence(t *presenceTracker, stream string, target presenceTarget, sessions []string) {
+	store := cb.Config.presence
+	gone, err := store.Touch(stream, sessions, cb.Config.presenceTTL)
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("Presence heartbeat of %s failed: %v", stream, err))
+
+		return
+	}
+
+	for _, member := range gone {
+		cb.publishPresence(target, "leave", member)
+	}
+
+	if len(sessions) > 0 {
+		return
+	}
+
+	if members, err := store.Members(stream); err != nil || len(members) > 0 {
+		return
+	}
+
+	t.mu.Lock()
+	if len(t.sessions[stream]) == 0 {
+		delete(t.streams, stream)
+	}
+	t.mu.Unlock()
+}
+
+func (cb *Cable) publishPresence(target presenceTarget, event string, member PresenceMember) {
+	data, _ := json.Marshal(&presenceEvent{Type: "presence", Event: event, ID: member.ID, Info: member.Info})
+
+	if err := cb.publish(newBroadcastMessage(target.channelName, target.broadcasting, data)); err != nil {
+		logger.Error(fmt.Sprintf("Publish the presence event to %s failed: %v", target.broadcasting, err))
+	}
+}
+
+// Join the presence set of the broadcasting as the connection identifier, with the info (JSON encoded) derived
+// from it, e.g. the name of the user. The subscribers of the broadcasting receive
+// `{"type":"presence","event":"join","id":"...","info":...}` when a member joins, and the `leave` events when the
+// member leaves, i.e. all of its sessions are unsubscribed, closed or expired.
+func (c *Channel) JoinPresence(broadcasting string, info any) error {
+	if c.conn.cable.Config.presence == nil {
+		return ErrPresenceDisabled
+	}
+
+	member := PresenceMember{ID: connectionGID(c.ConnIdentifier)}
+
+	if info != nil {
+		b, err := json.Marshal(info)
+
+		if err != nil {
+			return err
+		}
+
+		member.Info = b
+	}
+
+	c.mu.Lock()
+	if c.presences == nil {
+		c.presences = map[string]json.RawMessage{}
+	}
+	c.presences[broadcasting] = member.Info
+	c.mu.Unlock()
+
+	return c.conn.cable.joinPresence(presenceTarget{c.Name, broadcasting}, c.presenceSession(), member)
+}
+
+// Leave the presence set of the broadcasting. It's done automatically once the channel is unsubscribed.
+func (c *Channel) LeavePresence(broadcasting string) error {
+	c.mu.Lock()
+	_, ok := c.presences[broadcasting]
+	delete(c.presences, broadcasting)
+	c.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return c.conn.cable.leavePresence(presenceTarget{c.Name, broadcasting}, c.presenceSession())
+}
+
+func (c *Channel) leaveAllPresences() {
+	c.mu.Lock()
+	broadcastings := make([]string, 0, len(c.presences))
+	for broadcasting := range c.presences {
+		broadcastings = append(broadcastings, broadcasting)
+	}
+	c.mu.Unlock()
+
+	for _, broadcasting := range broadcastings {
+		if err := c.LeavePresence(broadcasting); err != nil {
+			logger.Error(fmt.Sprintf("Leave the presence of %s failed: %v", broadcasting, err))
+		}
+	}
+}
+
+// A subscription is a session of the member, so the member stays present until its last tab goes away.
+func (c *Channel) presenceSession() string {
+	return c.conn.sid + "/" + c.Identifier
+}
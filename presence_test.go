@@ -0,0 +1,177 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMemoryPresence(t *testing.T) {
+	p := NewMemoryPresence()
+
+	for _, c := range []struct {
+		session, id string
+		joined      bool
+	}{
+		{"s1", "user1", true},
+		{"s2", "user1", false},
+		{"s3", "user2", true},
+	} {
+		if joined, _ := p.Join("room", c.session, PresenceMember{ID: c.id}, time.Minute); joined != c.joined {
+			t.Errorf("Unexpected join of %s: %v", c.session, joined)
+		}
+	}
+
+	if members, _ := p.Members("room"); len(members) != 2 || members[0].ID != "user1" || members[1].ID != "user2" {
+		t.Errorf("Unexpected members: %+v", members)
+	}
+
+	if _, left, _ := p.Leave("room", "s1"); left {
+		t.Error("user1 left with a session left.")
+	}
+
+	if m, left, _ := p.Leave("room", "s2"); !left || m.ID != "user1" {
+		t.Errorf("Unexpected leave: %+v, %v", m, left)
+	}
+
+	p.Join("room", "s4", PresenceMember{ID: "user3"}, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	if members, _ := p.Members("room"); len(members) != 1 || members[0].ID != "user2" {
+		t.Errorf("Unexpected members: %+v", members)
+	}
+
+	if gone, _ := p.Touch("room", []string{"s3"}, time.Minute); len(gone) != 1 || gone[0].ID != "user3" {
+		t.Errorf("Unexpected expired members: %+v", gone)
+	}
+}
+
+func presenceEvents(ws *testWsConnection) []presenceEvent {
+	events := []presenceEvent{}
+
+	for _, msg := range ws.messages() {
+		cm, ok := msg.(channelMessage)
+
+		if !ok {
+			continue
+		}
+
+		b, _ := json.Marshal(cm.Message)
+		e := presenceEvent{}
+
+		if json.Unmarshal(b, &e) == nil && e.Type == "presence" {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+func TestPresence(t *testing.T) {
+	conn1, ws1 := newTestConnection("user1")
+	conn2, _ := newTestConnection("user2")
+	cable := conn1.cable
+	cable.Config.WithPresence(NewMemoryPresence(), 30*time.Millisecond)
+
+	conn2.cable = cable
+
+	cable.PubSub.Run()
+	defer cable.Stop()
+
+	conn1.Setup()
+	defer conn1.Close("test complete")
+
+	conn2.Setup()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFrom("room_1")
+			c.JoinPresence("room_1", map[string]any{"name": c.ConnIdentifier})
+		},
+		PerformAction: func(c *Channel, _ string) { c.LeavePresence("room_1") },
+	})
+
+	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`
+	conn1.wsConn.(*testWsConnection).write([]byte(data))
+	conn2.wsConn.(*testWsConnection).write([]byte(data))
+
+	if members, _ := cable.PresenceMembers("RoomChannel", "room_1"); len(members) != 2 || string(members[1].Info) != `{"name":"user2"}` {
+		t.Errorf("Unexpected members: %+v", members)
+	}
+
+	conn2.Close("test complete")
+	time.Sleep(5 * time.Millisecond)
+
+	if members, _ := cable.PresenceMembers("RoomChannel", "room_1"); len(members) != 1 || members[0].ID != "user1" {
+		t.Errorf("Unexpected members: %+v", members)
+	}
+
+	// A member of a crashed node expires without its heartbeat.
+	cable.Config.presence.Join(historyStream("RoomChannel", "room_1"), "dead", PresenceMember{ID: "user3"}, time.Millisecond)
+	time.Sleep(25 * time.Millisecond)
+
+	events := presenceEvents(ws1)
+	expected := []string{"join user2", "leave user2", "leave user3"}
+
+	if len(events) < len(expected) {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	for i, e := range events[len(events)-len(expected):] {
+		if e.Event+" "+e.ID != expected[i] {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	}
+
+	if members, _ := cable.PresenceMembers("RoomChannel", "room_1"); len(members) != 1 || members[0].ID != "user1" {
+		t.Errorf("The heartbeat doesn't keep user1 present: %+v", members)
+	}
+
+	// The stream is swept after the sessions of this node left it, until it has no members left.
+	cable.Config.presence.Join(historyStream("RoomChannel", "room_1"), "dead", PresenceMember{ID: "user4"}, 10*time.Millisecond)
+	ws1.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"action\":\"leave\"}"}`))
+	time.Sleep(40 * time.Millisecond)
+
+	events = presenceEvents(ws1)
+
+	if left := events[len(events)-2].ID + " " + events[len(events)-1].ID; left != "user1 user4" && left != "user4 user1" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+
+	cable.presence.mu.Lock()
+	defer cable.presence.mu.Unlock()
+
+	if len(cable.presence.streams) != 0 {
+		t.Errorf("The empty streams are still tracked: %+v", cable.presence.streams)
+	}
+}
+
+func TestPresenceTTL(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("The zero TTL is accepted.")
+		}
+	}()
+
+	NewConfig().WithPresence(NewMemoryPresence(), 0)
+}
+
+func TestRedisPresenceRequiresRedisPubSub(t *testing.T) {
+	// Either order of WithRedisPresence and WithRedisPubSub is fine.
+	cfg := NewConfig().WithRedisPresence(time.Minute).WithRedisPubSub(&redis.Options{})
+
+	if _, ok := cfg.presence.(*RedisPresence); !ok || cfg.presenceTTL != time.Minute {
+		t.Errorf("Unexpected presence: %+v", cfg.presence)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("The Redis presence is accepted without the Redis pubsub.")
+		}
+	}()
+
+	NewActionCable(NewConfig().WithRedisPresence(time.Minute))
+}
@@ -0,0 +1,206 @@
+package actioncable
+
+import (
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const protobufProtocol = "actioncable-v1-protobuf"
+
+// Codec for actioncable-v1-protobuf, the wire format is compatible with AnyCable's:
+//
+//	enum Type {
+//	  no_type = 0; welcome = 1; disconnect = 2; ping = 3; confirm_subscription = 4; reject_subscription = 5;
+//	  confirm_history = 6; reject_history = 7;
+//	}
+//
+//	enum Command {
+//	  unknown_command = 0; subscribe = 1; unsubscribe = 2; message = 3; whisper = 6;
+//	}
+//
+//	message Message {
+//	  Type type = 1;
+//	  Command command = 2;
+//	  string identifier = 3;
+//	  // JSON encoded string, by Action Cable protocol design.
+//	  string data = 4;
+//	  // Msgpack encoded, the message has no structure.
+//	  bytes message = 5;
+//	  string reason = 6;
+//	  bool reconnect = 7;
+//	  string sid = 9;
+//	  bool restored = 10;
+//	  repeated string restored_ids = 11;
+//	  string restore_token = 12;
+//	}
+type ProtobufCodec struct{}
+
+var (
+	_ Codec          = ProtobufCodec{}
+	_ PayloadEncoder = ProtobufCodec{}
+)
+
+// Field numbers of the Message.
+const (
+	pbFieldType         protowire.Number = 1
+	pbFieldCommand      protowire.Number = 2
+	pbFieldIdentifier   protowire.Number = 3
+	pbFieldData         protowire.Number = 4
+	pbFieldMessage      protowire.Number = 5
+	pbFieldReason       protowire.Number = 6
+	pbFieldReconnect    protowire.Number = 7
+	pbFieldSid          protowire.Number = 9
+	pbFieldRestored     protowire.Number = 10
+	pbFieldRestoredIDs  protowire.Number = 11
+	pbFieldRestoreToken protowire.Number = 12
+)
+
+var pbTypes = map[string]uint64{
+	"welcome":              1,
+	"disconnect":           2,
+	"ping":                 3,
+	"confirm_subscription": 4,
+	"reject_subscription":  5,
+	"confirm_history":      6,
+	"reject_history":       7,
+}
+
+var pbCommands = map[uint64]string{
+	1: "subscribe",
+	2: "unsubscribe",
+	3: "message",
+	6: "whisper",
+}
+
+func (ProtobufCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	switch m := v.(type) {
+	case map[string]string:
+		t, ok := pbTypes[m["type"]]
+
+		if !ok {
+			return nil, fmt.Errorf("can't encode message type %q to protobuf", m["type"])
+		}
+
+		b = pbAppendVarint(b, pbFieldType, t)
+		b = pbAppendString(b, pbFieldIdentifier, m["identifier"])
+	case *welcomeMessage:
+		b = pbAppendVarint(b, pbFieldType, pbTypes["welcome"])
+		b = pbAppendString(b, pbFieldSid, m.Sid)
+
+		if m.Restored {
+			b = pbAppendVarint(b, pbFieldRestored, 1)
+		}
+
+		for _, id := range m.RestoredIDs {
+			b = pbAppendString(b, pbFieldRestoredIDs, id)
+		}
+
+		b = pbAppendString(b, pbFieldRestoreToken, m.RestoreToken)
+	case *pingMessage:
+		b = pbAppendVarint(b, pbFieldType, pbTypes["ping"])
+		b, err = pbAppendPayload(b, m.Message)
+	case *disconnectMessage:
+		b = pbAppendVarint(b, pbFieldType, pbTypes["disconnect"])
+		b = pbAppendString(b, pbFieldReason, m.Reason)
+
+		if m.Reconnect {
+			b = pbAppendVarint(b, pbFieldReconnect, 1)
+		}
+	case channelMessage:
+		b = pbAppendString(b, pbFieldIdentifier, m.Identifier)
+		b, err = pbAppendPayload(b, m.Message)
+	default:
+		return nil, fmt.Errorf("can't encode %T to protobuf", v)
+	}
+
+	return b, err
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	cmd, ok := v.(*command)
+
+	if !ok {
+		return fmt.Errorf("can't decode protobuf into %T", v)
+	}
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		switch {
+		case num == pbFieldCommand && typ == protowire.VarintType:
+			var c uint64
+			c, n = protowire.ConsumeVarint(data)
+			cmd.Command = pbCommands[c]
+		case num == pbFieldIdentifier && typ == protowire.BytesType:
+			var s []byte
+			s, n = protowire.ConsumeBytes(data)
+			cmd.Identifier = string(s)
+		case num == pbFieldData && typ == protowire.BytesType:
+			var s []byte
+			s, n = protowire.ConsumeBytes(data)
+			cmd.Data = string(s)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
+
+// Channel messages carry msgpack encoded payloads, so they could be encoded once per broadcast.
+func (ProtobufCodec) EncodePayload(payload any) (any, error) {
+	return MsgpackCodec{}.EncodePayload(payload)
+}
+
+func pbAppendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func pbAppendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func pbAppendPayload(b []byte, payload any) ([]byte, error) {
+	raw, ok := payload.(msgpack.RawMessage)
+
+	if !ok {
+		var err error
+
+		if raw, err = msgpackMarshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	b = protowire.AppendTag(b, pbFieldMessage, protowire.BytesType)
+	return protowire.AppendBytes(b, raw), nil
+}
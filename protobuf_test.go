@@ -0,0 +1,181 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func encodeProtobufCommand(cmd uint64, identifier, data string) []byte {
+	b := pbAppendVarint(nil, pbFieldCommand, cmd)
+	b = pbAppendString(b, pbFieldIdentifier, identifier)
+
+	return pbAppendString(b, pbFieldData, data)
+}
+
+func decodeProtobufFrame(t *testing.T, frame any) map[string]any {
+	data, ok := frame.([]byte)
+
+	if !ok {
+		t.Fatalf("Unexpected frame: %+v", frame)
+	}
+
+	m := map[string]any{}
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+
+		if n < 0 {
+			t.Fatalf("Can't decode protobuf frame: %v", protowire.ParseError(n))
+		}
+
+		data = data[n:]
+
+		switch num {
+		case pbFieldType:
+			m["type"], n = protowire.ConsumeVarint(data)
+		case pbFieldIdentifier:
+			var s []byte
+			s, n = protowire.ConsumeBytes(data)
+			m["identifier"] = string(s)
+		case pbFieldMessage:
+			var b []byte
+			b, n = protowire.ConsumeBytes(data)
+
+			var payload any
+			if err := msgpackUnmarshal(b, &payload); err != nil {
+				t.Fatalf("Can't decode msgpack payload: %v", err)
+			}
+			m["message"] = payload
+		case pbFieldReason:
+			var s []byte
+			s, n = protowire.ConsumeBytes(data)
+			m["reason"] = string(s)
+		case pbFieldReconnect:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			m["reconnect"] = protowire.DecodeBool(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			t.Fatalf("Can't decode protobuf frame: %v", protowire.ParseError(n))
+		}
+
+		data = data[n:]
+	}
+
+	return m
+}
+
+func TestProtobufCommandRoundTrip(t *testing.T) {
+	cmd := &command{}
+	data := encodeProtobufCommand(3, `{"channel":"RoomChannel"}`, `{"action":"speak"}`)
+
+	if err := (ProtobufCodec{}).Unmarshal(data, cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.Command != "message" || cmd.Identifier != `{"channel":"RoomChannel"}` || cmd.Data != `{"action":"speak"}` {
+		t.Errorf("Unexpected command: %+v", cmd)
+	}
+
+	if err := (ProtobufCodec{}).Unmarshal(encodeProtobufCommand(6, `{"channel":"RoomChannel"}`, `{"event":"typing"}`), cmd); err != nil || cmd.Command != "whisper" {
+		t.Errorf("Unexpected command: %+v, %v", cmd, err)
+	}
+
+	if err := (ProtobufCodec{}).Unmarshal([]byte{0xff}, cmd); err == nil {
+		t.Error("Decoded a malformed command.")
+	}
+}
+
+func TestProtobufConnection(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	conn.protocol = &protocol{name: protobufProtocol, codec: ProtobufCodec{}}
+	cable := conn.cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	actions := []string{}
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			params := struct {
+				Name string `json:"name"`
+			}{}
+
+			json.Unmarshal(c.Params, &params)
+
+			if params.Name == "private" {
+				c.Reject()
+				return
+			}
+
+			c.StreamFrom("room_1")
+		},
+		PerformAction: func(_ *Channel, data string) { actions = append(actions, data) },
+	})
+
+	conn.Setup()
+	ws.waitMessages(t, 1)
+
+	lastFrame := func() map[string]any {
+		return decodeProtobufFrame(t, ws.lastMessage())
+	}
+
+	if m := decodeProtobufFrame(t, ws.messages()[0]); m["type"] != pbTypes["welcome"] {
+		t.Errorf("Unexpected welcome message: %+v", m)
+	}
+
+	ws.write(encodeProtobufCommand(1, `{"channel":"RoomChannel","name":"private"}`, ""))
+
+	if m := lastFrame(); m["type"] != pbTypes["reject_subscription"] || m["identifier"] != `{"channel":"RoomChannel","name":"private"}` {
+		t.Errorf("Unexpected reject message: %+v", m)
+	}
+
+	ws.write(encodeProtobufCommand(1, `{"channel":"RoomChannel"}`, ""))
+
+	if m := lastFrame(); m["type"] != pbTypes["confirm_subscription"] || m["identifier"] != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected confirm message: %+v", m)
+	}
+
+	ws.write(encodeProtobufCommand(3, `{"channel":"RoomChannel"}`, `{"action":"speak"}`))
+
+	if len(actions) != 1 || actions[0] != `{"action":"speak"}` {
+		t.Errorf("Unexpected actions: %+v", actions)
+	}
+
+	received := len(ws.messages())
+	cable.Broadcast("RoomChannel", "room_1", map[string]string{"hello": "actioncable"})
+	ws.waitMessages(t, received+1)
+
+	m := lastFrame()
+
+	if m["identifier"] != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected channel message: %+v", m)
+	}
+
+	if msg, ok := m["message"].(map[string]any); !ok || msg["hello"] != "actioncable" {
+		t.Errorf("Unexpected channel message: %+v", m)
+	}
+
+	ping := newPingMessage()
+	conn.enqueue(ping)
+	time.Sleep(5 * time.Millisecond)
+
+	if m := lastFrame(); m["type"] != pbTypes["ping"] || fmt.Sprint(m["message"]) != fmt.Sprint(ping.Message) {
+		t.Errorf("Unexpected ping message: %+v", m)
+	}
+
+	conn.Close("test complete")
+
+	if m := lastFrame(); m["type"] != pbTypes["disconnect"] || m["reason"] != "test complete" || m["reconnect"] != nil {
+		t.Errorf("Unexpected disconnect message: %+v", m)
+	}
+}
@@ -1,5 +1,10 @@
 package actioncable
 
+import (
+	"encoding/json"
+	"sync"
+)
+
 type PubSub interface {
 	Run() error
 	Stop() error
@@ -8,3 +13,70 @@ type PubSub interface {
 	Subscribe(channel *Channel, broadcasting string) error
 	Unsubscribe(channel *Channel, broadcasting string) error
 }
+
+// Implemented by the built-in PubSubs, which deliver the broadcastMessage (with its metadata, e.g. the
+// stream position) to the subscribers instead of the bare payload.
+type messagePublisher interface {
+	publish(msg *broadcastMessage) error
+}
+
+// A message published to a broadcasting. It's shared by all the subscribers of the broadcasting,
+// so the payload is decoded (and encoded per protocol) once per broadcast rather than once per subscriber.
+type broadcastMessage struct {
+	channelName  string
+	broadcasting string
+	data         []byte
+	// Set when the stream history is enabled.
+	position StreamPosition
+	// The session ID of the connection the message is not delivered to, i.e. the sender of a whisper.
+	exclude string
+
+	decodeOnce sync.Once
+	decoded    any
+	decodeErr  error
+
+	mu      sync.Mutex
+	encoded map[string]*encodedPayload
+	// `<protocol>/<identifier>` -> the channel message frame, see broadcastMessage.frame.
+	frames map[string]*preparedFrame
+}
+
+type encodedPayload struct {
+	once    sync.Once
+	payload any
+	err     error
+}
+
+func newBroadcastMessage(channelName, broadcasting string, data []byte) *broadcastMessage {
+	return &broadcastMessage{channelName: channelName, broadcasting: broadcasting, data: data}
+}
+
+// The payload to be transmitted to a connection speaking the given protocol.
+func (m *broadcastMessage) payload(p *protocol) (any, error) {
+	m.decodeOnce.Do(func() {
+		m.decodeErr = json.Unmarshal(m.data, &m.decoded)
+	})
+
+	pe, ok := p.codec.(PayloadEncoder)
+
+	if m.decodeErr != nil || !ok {
+		return m.decoded, m.decodeErr
+	}
+
+	m.mu.Lock()
+	if m.encoded == nil {
+		m.encoded = map[string]*encodedPayload{}
+	}
+	e, ok := m.encoded[p.name]
+	if !ok {
+		e = &encodedPayload{}
+		m.encoded[p.name] = e
+	}
+	m.mu.Unlock()
+
+	e.once.Do(func() {
+		e.payload, e.err = pe.EncodePayload(m.decoded)
+	})
+
+	return e.payload, e.err
+}
@@ -0,0 +1,348 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Returned when a connection is rejected for exceeding the quotas.
+var ErrQuotaExceeded = errors.New("actioncable: quota exceeded")
+
+// The caps of the subscriptions, streams and connections, the zero values don't cap them.
+type Quotas struct {
+	// The subscriptions of a connection. The subscribe commands exceeding are told `reject_subscription`.
+	SubscriptionsPerConnection int
+	// The streams of a subscription. Exceeding it in the Subscribed callback rejects the subscription, the streams
+	// exceeding it afterwards are ignored.
+	StreamsPerChannel int
+	// The connections of an identifier (cluster-wide with WithRedisQuotas). The new connections exceeding are closed
+	// with DisconnectQuotaExceeded, unless EvictOldest.
+	ConnectionsPerIdentifier int
+	// Close the oldest connections of the identifier with DisconnectEvicted instead, wherever they are.
+	EvictOldest bool
+	// The connections of this node. The new connections exceeding are closed with DisconnectQuotaExceeded.
+	ConnectionsPerNode int
+	// Counts the connections of the identifiers, NewMemoryConnectionQuota() by default.
+	Store ConnectionQuotaStore
+	// The connections of the crashed nodes stop counting after it, 30 seconds by default.
+	TTL time.Duration
+}
+
+// Counts the connections of the identifiers. The connections expire after the TTL unless they are touched by the
+// heartbeat of the node they're on.
+type ConnectionQuotaStore interface {
+	// Add the connection (by its session ID) of the identifier, returning all the connections of the identifier,
+	// the oldest first.
+	Add(identifier, sid string, ttl time.Duration) ([]string, error)
+	Remove(identifier, sid string) error
+	// Keep the connections of the identifier alive for another TTL.
+	Touch(identifier string, sids []string, ttl time.Duration) error
+}
+
+// A ConnectionQuotaStore in the process memory. It only suits the applications running on a single node.
+type MemoryConnectionQuota struct {
+	identifiers map[string]map[string]*memoryQuotaConnection
+	mu          sync.Mutex
+}
+
+type memoryQuotaConnection struct {
+	addedAt   time.Time
+	expiresAt time.Time
+}
+
+var _ ConnectionQuotaStore = (*MemoryConnectionQuota)(nil)
+
+func NewMemoryConnectionQuota() *MemoryConnectionQuota {
+	return &MemoryConnectionQuota{identifiers: map[string]map[string]*memoryQuotaConnection{}}
+}
+
+func (q *MemoryConnectionQuota) Add(identifier, sid string, ttl time.Duration) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	conns := q.identifiers[identifier]
+
+	if conns == nil {
+		conns = map[string]*memoryQuotaConnection{}
+		q.identifiers[identifier] = conns
+	}
+
+	for s, c := range conns {
+		if now.After(c.expiresAt) {
+			delete(conns, s)
+		}
+	}
+
+	if c, ok := conns[sid]; ok {
+		c.expiresAt = now.Add(ttl)
+	} else {
+		conns[sid] = &memoryQuotaConnection{addedAt: now, expiresAt: now.Add(ttl)}
+	}
+
+	sids := make([]string, 0, len(conns))
+	for s := range conns {
+		sids = append(sids, s)
+	}
+
+	sort.Slice(sids, func(i, j int) bool {
+		a, b := conns[sids[i]], conns[sids[j]]
+
+		return a.addedAt.Before(b.addedAt) || (a.addedAt.Equal(b.addedAt) && sids[i] < sids[j])
+	})
+
+	return sids, nil
+}
+
+func (q *MemoryConnectionQuota) Remove(identifier, sid string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.identifiers[identifier], sid)
+
+	if len(q.identifiers[identifier]) == 0 {
+		delete(q.identifiers, identifier)
+	}
+
+	return nil
+}
+
+func (q *MemoryConnectionQuota) Touch(identifier string, sids []string, ttl time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+
+	for _, sid := range sids {
+		if c, ok := q.identifiers[identifier][sid]; ok {
+			c.expiresAt = expiresAt
+		}
+	}
+
+	return nil
+}
+
+// The connections counted against the quotas on this node.
+type quotaTracker struct {
+	store ConnectionQuotaStore
+	ttl   time.Duration
+	nodes int
+	// session ID -> the quota key of the identifier, empty for the connections not counted by the store.
+	sessions map[string]string
+	stop     chan struct{}
+	mu       sync.Mutex
+}
+
+func (cb *Cable) quotaTracker() *quotaTracker {
+	cb.quotaOnce.Do(func() {
+		q := cb.Config.quotas
+		t := &quotaTracker{store: q.Store, ttl: q.TTL, sessions: map[string]string{}, stop: make(chan struct{})}
+
+		if t.store == nil {
+			t.store = NewMemoryConnectionQuota()
+		}
+
+		if t.ttl <= 0 {
+			t.ttl = 30 * time.Second
+		}
+
+		cb.quotas = t
+
+		if q.ConnectionsPerIdentifier > 0 {
+			go cb.heartbeatQuotas(t)
+		}
+	})
+
+	return cb.quotas
+}
+
+// Count the connection against the connection quotas, evicting the oldest connections of the identifier if
+// configured so.
+func (cb *Cable) acquireConnectionQuota(conn *Connection) error {
+	q := cb.Config.quotas
+
+	if q.ConnectionsPerNode <= 0 && q.ConnectionsPerIdentifier <= 0 {
+		return nil
+	}
+
+	t := cb.quotaTracker()
+
+	t.mu.Lock()
+	if q.ConnectionsPerNode > 0 && t.nodes >= q.ConnectionsPerNode {
+		t.mu.Unlock()
+
+		return fmt.Errorf("%w: %d connections on the node", ErrQuotaExceeded, q.ConnectionsPerNode)
+	}
+	t.nodes++
+	t.mu.Unlock()
+
+	key := ""
+
+	if q.ConnectionsPerIdentifier > 0 && conn.identifier != nil {
+		key = identityKey(conn.identifier)
+		sids, err := t.store.Add(key, conn.sid, t.ttl)
+
+		if err != nil {
+			// Let the connection in rather than locking everyone out when the store is down.
+			logger.Error(fmt.Sprintf("Count the connection of %s failed: %v", key, err))
+		} else if exceeded := len(sids) - q.ConnectionsPerIdentifier; exceeded > 0 {
+			if !q.EvictOldest {
+				t.store.Remove(key, conn.sid)
+				t.release()
+
+				return fmt.Errorf("%w: %d connections of %s", ErrQuotaExceeded, q.ConnectionsPerIdentifier, key)
+			}
+
+			for _, sid := range sids[:exceeded] {
+				if sid != conn.sid {
+					cb.evictConnection(sid)
+					t.store.Remove(key, sid)
+				}
+			}
+		}
+	}
+
+	t.mu.Lock()
+	t.sessions[conn.sid] = key
+	t.mu.Unlock()
+
+	return nil
+}
+
+// Stop counting the closed connection.
+func (cb *Cable) releaseConnectionQuota(conn *Connection) {
+	q := cb.Config.quotas
+
+	if q.ConnectionsPerNode <= 0 && q.ConnectionsPerIdentifier <= 0 {
+		return
+	}
+
+	t := cb.quotaTracker()
+
+	t.mu.Lock()
+	key, ok := t.sessions[conn.sid]
+	delete(t.sessions, conn.sid)
+	t.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	t.release()
+
+	if key == "" {
+		return
+	}
+
+	if err := t.store.Remove(key, conn.sid); err != nil {
+		logger.Error(fmt.Sprintf("Remove the connection of %s from the quota failed: %v", key, err))
+	}
+}
+
+func (t *quotaTracker) release() {
+	t.mu.Lock()
+	t.nodes--
+	t.mu.Unlock()
+}
+
+// Close the connection of the session wherever it is, by the internal broadcasting of the session.
+func (cb *Cable) evictConnection(sid string) {
+	logger.Info(fmt.Sprintf("Evicting the connection %s", sid))
+
+	msg, _ := json.Marshal(&remoteCommand{Type: "disconnect", Session: sid, Reason: "evicted"})
+
+	cb.PubSub.Broadcast(internalChannelName, sessionBroadcasting(sid), msg)
+}
+
+// The identity of the connection identifier, e.g. the connections are counted by it. Unlike the connection GID,
+// the different Identifiers never share it, e.g. `{"current_account":"1","current_user":"2"}`.
+func identityKey(identifier any) string {
+	if ids, ok := identifier.(Identifiers); ok {
+		b, _ := json.Marshal(ids)
+
+		return string(b)
+	}
+
+	return fmt.Sprintf("%v", identifier)
+}
+
+// Touch the connections of this node once per a third of the TTL.
+func (cb *Cable) heartbeatQuotas(t *quotaTracker) {
+	ticker := time.NewTicker(t.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			identifiers := map[string][]string{}
+
+			t.mu.Lock()
+			for sid, key := range t.sessions {
+				if key != "" {
+					identifiers[key] = append(identifiers[key], sid)
+				}
+			}
+			t.mu.Unlock()
+
+			for key, sids := range identifiers {
+				if err := t.store.Touch(key, sids, t.ttl); err != nil {
+					logger.Error(fmt.Sprintf("Quota heartbeat of %s failed: %v", key, err))
+				}
+			}
+		}
+	}
+}
+
+// Whether the connection could subscribe to one more channel. Re-subscribing doesn't count.
+func (conn *Connection) allowSubscription(subId string) bool {
+	limit := conn.cable.Config.quotas.SubscriptionsPerConnection
+
+	if limit <= 0 {
+		return true
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	n := 0
+
+	for _, channels := range conn.channels {
+		if _, ok := channels[subId]; ok {
+			return true
+		}
+
+		n += len(channels)
+	}
+
+	return n < limit
+}
+
+// Count the stream against the quota of the channel, which is released by StopStreamFrom. It's called holding c.mu.
+func (c *Channel) allowStream(broadcasting string) bool {
+	limit := c.conn.cable.Config.quotas.StreamsPerChannel
+
+	if limit <= 0 {
+		return true
+	}
+
+	if _, ok := c.quotaStreams[broadcasting]; ok {
+		return true
+	}
+
+	if len(c.quotaStreams) >= limit {
+		return false
+	}
+
+	if c.quotaStreams == nil {
+		c.quotaStreams = map[string]struct{}{}
+	}
+	c.quotaStreams[broadcasting] = struct{}{}
+
+	return true
+}
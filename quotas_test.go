@@ -0,0 +1,209 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMemoryConnectionQuota(t *testing.T) {
+	q := NewMemoryConnectionQuota()
+
+	q.Add("user1", "a", time.Minute)
+	time.Sleep(time.Millisecond)
+	q.Add("user1", "b", 5*time.Millisecond)
+	time.Sleep(time.Millisecond)
+	sids, _ := q.Add("user1", "c", time.Minute)
+
+	if len(sids) != 3 || sids[0] != "a" || sids[1] != "b" || sids[2] != "c" {
+		t.Errorf("Unexpected connections: %v", sids)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	q.Remove("user1", "a")
+	sids, _ = q.Add("user1", "d", time.Minute)
+
+	if len(sids) != 2 || sids[0] != "c" || sids[1] != "d" {
+		t.Errorf("Unexpected connections: %v", sids)
+	}
+}
+
+func TestSubscriptionQuotas(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+	cable.Config.WithQuotas(Quotas{SubscriptionsPerConnection: 2, StreamsPerChannel: 2})
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			var p struct {
+				Streams int `json:"streams"`
+			}
+			json.Unmarshal(c.Params, &p)
+
+			for i := 0; i < p.Streams; i++ {
+				c.StreamFrom(string(rune('a' + i)))
+			}
+		},
+		Actions: map[string]ChannelActionCallback{
+			"stream": func(c *Channel, data json.RawMessage) { c.StreamFrom("z") },
+		},
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	types := func(from int) []string {
+		types := []string{}
+		for _, m := range ws.messages()[from:] {
+			if m, ok := m.(map[string]string); ok {
+				types = append(types, m["type"])
+			}
+		}
+		return types
+	}
+
+	sent := len(ws.messages())
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\",\"streams\":3}"}`))
+
+	if ts := types(sent); len(ts) == 0 || ts[len(ts)-1] != "reject_subscription" {
+		t.Errorf("The subscription exceeding the streams quota is not rejected: %v", ts)
+	}
+
+	for _, id := range []string{`1`, `2`, `3`, `1`} {
+		sent = len(ws.messages())
+		ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\",\"streams\":` + id + `}"}`))
+		ts := types(sent)
+
+		if expected := id != "3"; (len(ts) == 1 && ts[0] == "confirm_subscription") != expected {
+			t.Errorf("Unexpected messages of the subscription %s: %v", id, ts)
+		}
+	}
+
+	// The streams exceeding the quota after subscribed are ignored.
+	ws.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\",\"streams\":2}", "data":"{\"action\":\"stream\"}"}`))
+	ws.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\",\"streams\":1}", "data":"{\"action\":\"stream\"}"}`))
+
+	for _, sub := range conn.Info().Subscriptions {
+		if len(sub.Streams) != 2 {
+			t.Errorf("Unexpected streams of %s: %v", sub.Identifier, sub.Streams)
+		}
+	}
+}
+
+func TestConnectionQuotas(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	reasons := make(chan DisconnectReason, 4)
+	cable.Config.WithOnDisconnect(func(c *Connection, r DisconnectReason) { reasons <- r })
+
+	connect := func(id any) (*Connection, *testWsConnection, error) {
+		_, ws := newTestConnection(id)
+		conn, err := cable.connect(id, ws, &protocol{name: jsonProtocol, codec: JSONCodec{}}, nil)
+
+		return conn, ws, err
+	}
+
+	expect := func(r DisconnectReason) {
+		t.Helper()
+
+		select {
+		case reason := <-reasons:
+			if reason != r {
+				t.Errorf("Expected %v, got %v", r, reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %v", r)
+		}
+	}
+
+	cable.Config.WithQuotas(Quotas{ConnectionsPerIdentifier: 1, ConnectionsPerNode: 2})
+
+	user1, _, _ := connect("user1")
+	user2, _, _ := connect("user2")
+
+	if _, ws, err := connect("user3"); !errors.Is(err, ErrQuotaExceeded) || !ws.isClosed {
+		t.Errorf("The connection exceeding the node quota is not rejected: %v", err)
+	}
+	expect(DisconnectQuotaExceeded)
+
+	user2.Close("bye")
+	expect(DisconnectServerClosed)
+
+	if _, _, err := connect("user1"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("The connection exceeding the identifier quota is not rejected: %v", err)
+	}
+	expect(DisconnectQuotaExceeded)
+
+	// Evict the oldest instead.
+	cable.Config.quotas.EvictOldest = true
+
+	newer, _, err := connect("user1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newer.Close("test complete")
+
+	expect(DisconnectEvicted)
+
+	if !user1.isClosed() || newer.isClosed() {
+		t.Error("The oldest connection is not evicted.")
+	}
+
+	if n := cable.Connections.Count(); n != 1 {
+		t.Errorf("Expected 1 connection, got %d", n)
+	}
+
+	// The Identifiers sharing the connection GID are counted apart.
+	cable.Config.quotas.ConnectionsPerNode = 0
+
+	first, _, err := connect(Identifiers{"current_account": "1", "current_user": "2"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close("test complete")
+
+	second, _, err := connect(Identifiers{"current_account": "2", "current_user": "1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close("test complete")
+
+	select {
+	case r := <-reasons:
+		t.Errorf("Unexpected disconnection: %v", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if first.isClosed() || second.isClosed() {
+		t.Error("The connection of another identifier is evicted.")
+	}
+}
+
+func TestRedisQuotasRequiresRedisPubSub(t *testing.T) {
+	// Either order of WithRedisQuotas and WithRedisPubSub is fine.
+	cfg := NewConfig().WithRedisQuotas(Quotas{ConnectionsPerIdentifier: 2}).WithRedisPubSub(&redis.Options{})
+
+	if _, ok := cfg.quotas.Store.(*RedisConnectionQuota); !ok || cfg.quotas.ConnectionsPerIdentifier != 2 {
+		t.Errorf("Unexpected quotas: %+v", cfg.quotas)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("The Redis quotas are accepted without the Redis pubsub.")
+		}
+	}()
+
+	NewActionCable(NewConfig().WithRedisQuotas(Quotas{ConnectionsPerIdentifier: 2}))
+}
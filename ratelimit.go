@@ -0,0 +1,214 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Returned for the commands exceeding the rate limits, see LimitCommands.
+var ErrRateLimited = errors.New("actioncable: rate limit exceeded")
+
+// A token bucket: Burst commands are allowed at once, and one more every interval (which must be positive).
+type RateLimit struct {
+	Burst int
+	Every time.Duration
+}
+
+// What to do with the commands exceeding the rate limits.
+type RateLimitPolicy int
+
+const (
+	// Drop the command, the subscribe commands are told `reject_subscription`.
+	RateLimitDrop RateLimitPolicy = iota + 1
+	// Hold the command (and the following ones of the connection) until it's allowed.
+	RateLimitDelay
+	// Close the connection with DisconnectRateLimited.
+	RateLimitDisconnect
+)
+
+// The limits of the commands per connection, see LimitCommands.
+type RateLimiter struct {
+	// The limit of all the commands of a connection, the zero value doesn't limit them.
+	Connection RateLimit
+	// The limits of the message commands of a connection, keyed by `<channel>#<action>` (e.g. `RoomChannel#speak`),
+	// or by `<channel>` for all the actions of the channel.
+	Actions map[string]RateLimit
+	// RateLimitDrop by default.
+	Policy RateLimitPolicy
+	// Called for every command exceeding the limits, e.g. to alert on the abusive identifiers.
+	OnViolation func(v *RateLimitViolation)
+}
+
+// A command exceeding a rate limit.
+type RateLimitViolation struct {
+	Connection *Connection
+	Command    *Command
+	// `connection`, or the key of RateLimiter.Actions.
+	Scope  string
+	Policy RateLimitPolicy
+}
+
+// Limit the commands of every connection by the token buckets of the limiter.
+//
+// E.g.
+//
+//	cbCfg.WithCommandMiddleware(actioncable.LimitCommands(&actioncable.RateLimiter{
+//	  Connection: actioncable.RateLimit{Burst: 50, Every: 100 * time.Millisecond},
+//	  Actions:    map[string]actioncable.RateLimit{"RoomChannel#speak": {Burst: 5, Every: time.Second}},
+//	  Policy:     actioncable.RateLimitDisconnect,
+//	}))
+func LimitCommands(l *RateLimiter) CommandMiddleware {
+	for scope, limit := range l.Actions {
+		if limit.Burst > 0 && limit.Every <= 0 {
+			panic(fmt.Sprintf("invalid rate limit of %s: %+v", scope, limit))
+		}
+	}
+
+	if l.Connection.Burst > 0 && l.Connection.Every <= 0 {
+		panic(fmt.Sprintf("invalid rate limit of the connections: %+v", l.Connection))
+	}
+
+	policy := l.Policy
+
+	if policy == 0 {
+		policy = RateLimitDrop
+	}
+
+	// The buckets are kept by the connections, keyed by the limiter and the scope.
+	prefix := fmt.Sprintf("%p/", l)
+
+	return func(next CommandHandler) CommandHandler {
+		return func(conn *Connection, cmd *Command) error {
+			for _, scope := range l.scopes(cmd) {
+				limit := l.Connection
+				if scope != "connection" {
+					limit = l.Actions[scope]
+				}
+
+				if limit.Burst <= 0 {
+					continue
+				}
+
+				wait := conn.rateLimitBucket(prefix+scope, limit).take(time.Now(), policy == RateLimitDelay)
+
+				if wait == 0 {
+					continue
+				}
+
+				logger.Error(fmt.Sprintf("Rate limit of %s exceeded by %v: %s %s", scope, conn.identifier, cmd.Command, cmd.Identifier))
+
+				if l.OnViolation != nil {
+					l.OnViolation(&RateLimitViolation{Connection: conn, Command: cmd, Scope: scope, Policy: policy})
+				}
+
+				switch policy {
+				case RateLimitDelay:
+					select {
+					case <-time.After(wait):
+					case <-conn.done:
+						return ErrRateLimited
+					}
+				case RateLimitDisconnect:
+					conn.close(DisconnectRateLimited, "rate limited.")
+
+					return ErrRateLimited
+				default:
+					return ErrRateLimited
+				}
+			}
+
+			return next(conn, cmd)
+		}
+	}
+}
+
+// The scopes of the limits the command counts against.
+func (l *RateLimiter) scopes(cmd *Command) []string {
+	scopes := []string{"connection"}
+
+	if cmd.Command != "message" || len(l.Actions) == 0 {
+		return scopes
+	}
+
+	if _, ok := l.Actions[cmd.Channel]; ok {
+		scopes = append(scopes, cmd.Channel)
+	}
+
+	var data struct {
+		Action string `json:"action"`
+	}
+
+	if err := json.Unmarshal([]byte(cmd.Data), &data); err == nil && data.Action != "" {
+		if _, ok := l.Actions[cmd.Channel+"#"+data.Action]; ok {
+			scopes = append(scopes, cmd.Channel+"#"+data.Action)
+		}
+	}
+
+	return scopes
+}
+
+func (conn *Connection) rateLimitBucket(key string, limit RateLimit) *tokenBucket {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.rateLimits == nil {
+		conn.rateLimits = map[string]*tokenBucket{}
+	}
+
+	b, ok := conn.rateLimits[key]
+
+	if !ok {
+		b = newTokenBucket(limit)
+		conn.rateLimits[key] = b
+	}
+
+	return b
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst)}
+}
+
+// Take a token, returning how long to wait for it if there's none. With reserve, the token is taken in advance
+// to be waited for, otherwise it's not taken.
+func (b *tokenBucket) take(now time.Time, reserve bool) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.limit.Every)
+
+		if burst := float64(b.limit.Burst); b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return 0
+	}
+
+	wait := time.Duration((1 - b.tokens) * float64(b.limit.Every))
+
+	if wait <= 0 {
+		wait = 1
+	}
+
+	if reserve {
+		b.tokens--
+	}
+
+	return wait
+}
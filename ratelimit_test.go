@@ -0,0 +1,151 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{Burst: 2, Every: time.Second})
+	now := time.Now()
+
+	if b.take(now, false) != 0 || b.take(now, false) != 0 {
+		t.Error("The burst is not allowed.")
+	}
+
+	if wait := b.take(now, false); wait != time.Second {
+		t.Errorf("Expected to wait for a second, got %v", wait)
+	}
+
+	if wait := b.take(now.Add(500*time.Millisecond), true); wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait for 500ms, got %v", wait)
+	}
+
+	// The reserved token is taken.
+	if wait := b.take(now.Add(time.Second), false); wait != time.Second {
+		t.Errorf("Expected to wait for a second, got %v", wait)
+	}
+
+	if b.take(now.Add(time.Minute), false) != 0 || b.take(now.Add(time.Minute), false) != 0 || b.take(now.Add(time.Minute), false) == 0 {
+		t.Error("The bucket is not refilled up to the burst.")
+	}
+}
+
+func newRateLimitedConnection(l *RateLimiter) (*Connection, *testWsConnection, *[]string) {
+	conn, ws := newTestConnection("user1")
+	performed := []string{}
+
+	conn.cable.Config.WithCommandMiddleware(LimitCommands(l))
+	conn.cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Actions: map[string]ChannelActionCallback{
+			"speak": func(c *Channel, data json.RawMessage) { performed = append(performed, "speak") },
+			"look":  func(c *Channel, data json.RawMessage) { performed = append(performed, "look") },
+		},
+	})
+
+	conn.Setup()
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+
+	return conn, ws, &performed
+}
+
+func perform(ws *testWsConnection, action string) {
+	ws.write([]byte(`{"command":"message", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"action\":\"` + action + `\"}"}`))
+}
+
+func TestRateLimitDrop(t *testing.T) {
+	violations := []string{}
+
+	conn, ws, performed := newRateLimitedConnection(&RateLimiter{
+		Connection: RateLimit{Burst: 4, Every: time.Minute},
+		Actions:    map[string]RateLimit{"RoomChannel#speak": {Burst: 1, Every: time.Minute}},
+		OnViolation: func(v *RateLimitViolation) {
+			violations = append(violations, v.Scope)
+		},
+	})
+	defer conn.Close("test complete")
+
+	// The subscription took a token of the connection.
+	perform(ws, "speak")
+	perform(ws, "speak")
+	perform(ws, "look")
+	perform(ws, "look")
+	perform(ws, "look")
+
+	if len(*performed) != 2 || (*performed)[0] != "speak" || (*performed)[1] != "look" {
+		t.Errorf("Unexpected actions performed: %v", *performed)
+	}
+
+	if len(violations) != 3 || violations[0] != "RoomChannel#speak" || violations[1] != "connection" {
+		t.Errorf("Unexpected violations: %v", violations)
+	}
+
+	if conn.isClosed() {
+		t.Error("The connection is closed.")
+	}
+}
+
+func TestRateLimitDisconnect(t *testing.T) {
+	conn, ws, performed := newRateLimitedConnection(&RateLimiter{
+		Connection: RateLimit{Burst: 2, Every: time.Minute},
+		Policy:     RateLimitDisconnect,
+	})
+
+	reasons := make(chan DisconnectReason, 1)
+	conn.cable.Config.WithOnDisconnect(func(c *Connection, r DisconnectReason) { reasons <- r })
+
+	perform(ws, "speak")
+
+	go perform(ws, "speak")
+
+	select {
+	case r := <-reasons:
+		if r != DisconnectRateLimited {
+			t.Errorf("Unexpected reason: %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The connection is not closed.")
+	}
+
+	if len(*performed) != 1 {
+		t.Errorf("Unexpected actions performed: %v", *performed)
+	}
+
+	// The subscription rate limited by the disconnection isn't rejected to the closed connection.
+	identifier := `{"channel":"RoomChannel","id":"disconnected"}`
+	conn.executeCommand(&command{Command: "subscribe", Identifier: identifier})
+
+	l := getCurrentTestLogger()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, msg := range l.infoMessages {
+		if strings.Contains(msg, identifier) {
+			t.Errorf("The subscription is rejected to the closed connection: %s", msg)
+		}
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	conn, ws, performed := newRateLimitedConnection(&RateLimiter{
+		Connection: RateLimit{Burst: 1, Every: 30 * time.Millisecond},
+		Policy:     RateLimitDelay,
+	})
+	defer conn.Close("test complete")
+
+	start := time.Now()
+	perform(ws, "speak")
+	perform(ws, "speak")
+	time.Sleep(40 * time.Millisecond)
+
+	if len(*performed) != 2 {
+		t.Errorf("The delayed actions are not performed: %v", *performed)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("The actions are not delayed: %v", elapsed)
+	}
+}
@@ -0,0 +1,155 @@
+package actioncable
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// A HistoryStore with Redis backend, shared by all the nodes. Every stream is kept in a Redis stream
+// trimmed to Size entries, its offset counter and epoch are kept aside. All of them expire after TTL
+// without new messages.
+type RedisHistory struct {
+	Client *redis.Client
+	Size   int
+	TTL    time.Duration
+}
+
+var _ HistoryStore = (*RedisHistory)(nil)
+
+const redisHistoryPrefix = "_action_cable_history/"
+
+// KEYS: entries, offset, epoch. ARGV: data, size, ttl (seconds), new epoch.
+// A missing epoch means the history is lost, so it starts over in a new epoch.
+var redisHistoryAppend = redis.NewScript(`
+local epoch = redis.call('GET', KEYS[3])
+if not epoch then
+  epoch = ARGV[4]
+  redis.call('DEL', KEYS[1], KEYS[2])
+  redis.call('SET', KEYS[3], epoch)
+end
+local offset = redis.call('INCR', KEYS[2])
+redis.call('XADD', KEYS[1], 'MAXLEN', ARGV[2], '*', 'o', offset, 'd', ARGV[1])
+for i = 1, 3 do
+  redis.call('EXPIRE', KEYS[i], ARGV[3])
+end
+return {epoch, offset}
+`)
+
+func (r *RedisHistory) Append(stream string, data []byte) (StreamPosition, error) {
+	ctx := context.TODO()
+	keys := r.keys(stream)
+	ttl := int64(r.TTL / time.Second)
+
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	res, err := redisHistoryAppend.Run(ctx, r.Client, keys, data, r.Size, ttl, randomID()).Slice()
+
+	if err != nil {
+		return StreamPosition{}, err
+	}
+
+	if len(res) != 2 {
+		return StreamPosition{}, fmt.Errorf("unexpected reply: %v", res)
+	}
+
+	epoch, _ := res[0].(string)
+	offset, _ := res[1].(int64)
+
+	return StreamPosition{Epoch: epoch, Offset: uint64(offset)}, nil
+}
+
+func (r *RedisHistory) After(stream string, pos StreamPosition) ([]HistoryEntry, error) {
+	ctx := context.TODO()
+	keys := r.keys(stream)
+
+	epoch, err := r.Client.Get(ctx, keys[2]).Result()
+
+	if err == redis.Nil {
+		return nil, ErrHistoryUnavailable
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if epoch != pos.Epoch {
+		return nil, ErrHistoryUnavailable
+	}
+
+	entries, err := r.read(ctx, stream, epoch, "-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 || entries[0].Offset > pos.Offset+1 {
+		last, _ := r.Client.Get(ctx, keys[1]).Uint64()
+
+		if last != pos.Offset {
+			return nil, ErrHistoryUnavailable
+		}
+	}
+
+	for i, e := range entries {
+		if e.Offset > pos.Offset {
+			return entries[i:], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *RedisHistory) Since(stream string, since time.Time) ([]HistoryEntry, error) {
+	ctx := context.TODO()
+
+	epoch, err := r.Client.Get(ctx, r.keys(stream)[2]).Result()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The IDs of the Redis stream entries are prefixed by the milliseconds they are added.
+	return r.read(ctx, stream, epoch, strconv.FormatInt(since.UnixMilli(), 10))
+}
+
+func (r *RedisHistory) read(ctx context.Context, stream, epoch, start string) ([]HistoryEntry, error) {
+	messages, err := r.Client.XRange(ctx, r.keys(stream)[0], start, "+").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, 0, len(messages))
+
+	for _, m := range messages {
+		offset, _ := strconv.ParseUint(fmt.Sprint(m.Values["o"]), 10, 64)
+		data, _ := m.Values["d"].(string)
+		ms, _ := strconv.ParseInt(strings.SplitN(m.ID, "-", 2)[0], 10, 64)
+
+		entries = append(entries, HistoryEntry{
+			StreamPosition: StreamPosition{Epoch: epoch, Offset: offset},
+			Data:           []byte(data),
+			Time:           time.UnixMilli(ms),
+		})
+	}
+
+	return entries, nil
+}
+
+// The keys of the entries, the offset counter and the epoch of the stream.
+func (r *RedisHistory) keys(stream string) []string {
+	key := redisHistoryPrefix + stream
+
+	return []string{key, key + "/offset", key + "/epoch"}
+}
@@ -0,0 +1,192 @@
+package actioncable
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// A PresenceStore with Redis backend, shared by all the nodes. The sessions of a stream are kept in a sorted set
+// scored by their expiration (in milliseconds), and their members in a hash. Both expire after the TTL without
+// any heartbeat, e.g. when all the nodes are gone.
+type RedisPresence struct {
+	Client *redis.Client
+}
+
+var _ PresenceStore = (*RedisPresence)(nil)
+
+const redisPresencePrefix = "_action_cable_presence/"
+
+// The common part of the scripts. KEYS: sessions, members. ARGV[1]: now.
+// present(id) tells whether the member has an alive session.
+const redisPresenceHelpers = `
+local now = tonumber(ARGV[1])
+local function present(id)
+  for _, session in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], now, '+inf')) do
+    local m = redis.call('HGET', KEYS[2], session)
+    if m and cjson.decode(m).id == id then
+      return true
+    end
+  end
+  return false
+end
+`
+
+// ARGV: now, expiration, ttl (milliseconds), session, member id, member.
+var redisPresenceJoin = redis.NewScript(redisPresenceHelpers + `
+local joined = not present(ARGV[5])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('HSET', KEYS[2], ARGV[4], ARGV[6])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+if joined then
+  return 1
+end
+return 0
+`)
+
+// ARGV: now, session. It returns the member if it has no sessions left.
+var redisPresenceLeave = redis.NewScript(redisPresenceHelpers + `
+local m = redis.call('HGET', KEYS[2], ARGV[2])
+redis.call('ZREM', KEYS[1], ARGV[2])
+redis.call('HDEL', KEYS[2], ARGV[2])
+if not m or present(cjson.decode(m).id) then
+  return false
+end
+return m
+`)
+
+// ARGV: now, expiration, ttl (milliseconds), sessions... It returns the members gone with the expired sessions.
+var redisPresenceTouch = redis.NewScript(redisPresenceHelpers + `
+for i = 4, #ARGV do
+  if redis.call('ZSCORE', KEYS[1], ARGV[i]) then
+    redis.call('ZADD', KEYS[1], ARGV[2], ARGV[i])
+  end
+end
+local gone = {}
+for _, session in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])) do
+  local m = redis.call('HGET', KEYS[2], session)
+  redis.call('ZREM', KEYS[1], session)
+  redis.call('HDEL', KEYS[2], session)
+  if m then
+    table.insert(gone, m)
+  end
+end
+local left = {}
+for _, m in ipairs(gone) do
+  if not present(cjson.decode(m).id) then
+    table.insert(left, m)
+  end
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[3])
+  redis.call('PEXPIRE', KEYS[2], ARGV[3])
+end
+return left
+`)
+
+func (r *RedisPresence) Join(stream, session string, member PresenceMember, ttl time.Duration) (bool, error) {
+	b, err := json.Marshal(member)
+
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	joined, err := redisPresenceJoin.Run(context.TODO(), r.Client, r.keys(stream),
+		now.UnixMilli(), now.Add(ttl).UnixMilli(), ttl.Milliseconds(), session, member.ID, b).Int()
+
+	return joined == 1, err
+}
+
+func (r *RedisPresence) Leave(stream, session string) (PresenceMember, bool, error) {
+	m, err := redisPresenceLeave.Run(context.TODO(), r.Client, r.keys(stream), time.Now().UnixMilli(), session).Text()
+
+	if err == redis.Nil {
+		return PresenceMember{}, false, nil
+	}
+
+	if err != nil {
+		return PresenceMember{}, false, err
+	}
+
+	member := PresenceMember{}
+	err = json.Unmarshal([]byte(m), &member)
+
+	return member, err == nil, err
+}
+
+func (r *RedisPresence) Touch(stream string, sessions []string, ttl time.Duration) ([]PresenceMember, error) {
+	now := time.Now()
+	args := []any{now.UnixMilli(), now.Add(ttl).UnixMilli(), ttl.Milliseconds()}
+
+	for _, session := range sessions {
+		args = append(args, session)
+	}
+
+	res, err := redisPresenceTouch.Run(context.TODO(), r.Client, r.keys(stream), args...).StringSlice()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePresenceMembers(res)
+}
+
+func (r *RedisPresence) Members(stream string) ([]PresenceMember, error) {
+	ctx := context.TODO()
+	keys := r.keys(stream)
+
+	sessions, err := r.Client.ZRangeByScore(ctx, keys[0], &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+
+	if err != nil || len(sessions) == 0 {
+		return []PresenceMember{}, err
+	}
+
+	values, err := r.Client.HMGet(ctx, keys[1], sessions...).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(values))
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			res = append(res, s)
+		}
+	}
+
+	members, err := decodePresenceMembers(res)
+
+	return uniquePresenceMembers(members), err
+}
+
+// The keys of the sessions and the members of the stream.
+func (r *RedisPresence) keys(stream string) []string {
+	key := redisPresencePrefix + stream
+
+	return []string{key + "/sessions", key + "/members"}
+}
+
+func decodePresenceMembers(values []string) ([]PresenceMember, error) {
+	members := make([]PresenceMember, 0, len(values))
+
+	for _, v := range values {
+		m := PresenceMember{}
+
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			return nil, err
+		}
+
+		members = append(members, m)
+	}
+
+	return members, nil
+}
@@ -16,12 +16,18 @@ type RedisPubSub struct {
 	done   chan struct{}
 }
 
-var _ PubSub = (*RedisPubSub)(nil)
+var (
+	_ PubSub           = (*RedisPubSub)(nil)
+	_ messagePublisher = (*RedisPubSub)(nil)
+)
 
 type broadcastingMessage struct {
 	ChannelName  string `json:"channel_name"`
 	Broadcasting string `json:"broadcasting"`
 	Message      string `json:"message"`
+	Epoch        string `json:"epoch,omitempty"`
+	Offset       uint64 `json:"offset,omitempty"`
+	Exclude      string `json:"exclude,omitempty"`
 }
 
 const redisChannelName = "_action_cable_internal"
@@ -50,7 +56,11 @@ func (r *RedisPubSub) Run() error {
 					continue
 				}
 
-				r.sm.Broadcast(m.ChannelName, m.Broadcasting, []byte(m.Message))
+				bm := newBroadcastMessage(m.ChannelName, m.Broadcasting, []byte(m.Message))
+				bm.position = StreamPosition{Epoch: m.Epoch, Offset: m.Offset}
+				bm.exclude = m.Exclude
+
+				r.sm.publish(bm)
 			case <-r.done:
 				return
 			}
@@ -76,12 +86,19 @@ func (r *RedisPubSub) Subscribe(c *Channel, broadcasting string) error {
 }
 
 func (r *RedisPubSub) Broadcast(channelName, broadcasting string, message []byte) error {
-	msg := broadcastingMessage{
-		ChannelName:  channelName,
-		Broadcasting: broadcasting,
-		Message:      string(message),
+	return r.publish(newBroadcastMessage(channelName, broadcasting, message))
+}
+
+func (r *RedisPubSub) publish(msg *broadcastMessage) error {
+	m := broadcastingMessage{
+		ChannelName:  msg.channelName,
+		Broadcasting: msg.broadcasting,
+		Message:      string(msg.data),
+		Epoch:        msg.position.Epoch,
+		Offset:       msg.position.Offset,
+		Exclude:      msg.exclude,
 	}
-	b, _ := json.Marshal(msg)
+	b, _ := json.Marshal(m)
 
 	return r.Client.Publish(context.TODO(), redisChannelName, b).Err()
 }
@@ -0,0 +1,83 @@
+package actioncable
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// A ConnectionQuotaStore with Redis backend, shared by all the nodes. The connections of an identifier are kept in
+// a sorted set scored by when they're added, and another one scored by their expiration (in milliseconds). Both
+// expire after the TTL without any heartbeat, e.g. when all the nodes are gone.
+type RedisConnectionQuota struct {
+	Client *redis.Client
+}
+
+var _ ConnectionQuotaStore = (*RedisConnectionQuota)(nil)
+
+const redisQuotaPrefix = "_action_cable_connections/"
+
+// KEYS: connections, expirations. ARGV: now, expiration, ttl (milliseconds), session ID.
+// It returns the alive connections, the oldest first.
+var redisQuotaAdd = redis.NewScript(`
+for _, sid in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])) do
+  redis.call('ZREM', KEYS[1], sid)
+  redis.call('ZREM', KEYS[2], sid)
+end
+redis.call('ZADD', KEYS[1], 'NX', ARGV[1], ARGV[4])
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return redis.call('ZRANGE', KEYS[1], 0, -1)
+`)
+
+// KEYS: connections, expirations. ARGV: expiration, ttl (milliseconds), session IDs...
+var redisQuotaTouch = redis.NewScript(`
+for i = 3, #ARGV do
+  if redis.call('ZSCORE', KEYS[1], ARGV[i]) then
+    redis.call('ZADD', KEYS[2], ARGV[1], ARGV[i])
+  end
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+return 0
+`)
+
+func (r *RedisConnectionQuota) Add(identifier, sid string, ttl time.Duration) ([]string, error) {
+	now := time.Now()
+
+	return redisQuotaAdd.Run(context.TODO(), r.Client, r.keys(identifier),
+		now.UnixMilli(), now.Add(ttl).UnixMilli(), ttl.Milliseconds(), sid).StringSlice()
+}
+
+func (r *RedisConnectionQuota) Remove(identifier, sid string) error {
+	keys := r.keys(identifier)
+
+	_, err := r.Client.TxPipelined(context.TODO(), func(pipe redis.Pipeliner) error {
+		pipe.ZRem(context.TODO(), keys[0], sid)
+		pipe.ZRem(context.TODO(), keys[1], sid)
+
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisConnectionQuota) Touch(identifier string, sids []string, ttl time.Duration) error {
+	args := []any{time.Now().Add(ttl).UnixMilli(), ttl.Milliseconds()}
+
+	for _, sid := range sids {
+		args = append(args, sid)
+	}
+
+	return redisQuotaTouch.Run(context.TODO(), r.Client, r.keys(identifier), args...).Err()
+}
+
+func (r *RedisConnectionQuota) keys(identifier string) []string {
+	key := redisQuotaPrefix + identifier
+
+	return []string{key, key + "/expires"}
+}
@@ -0,0 +1,204 @@
+package actioncable
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The connections on this node, indexed by their identifiers.
+type ConnectionRegistry struct {
+	connections map[*Connection]struct{}
+	// connection GID -> connections, see connectionGID.
+	byIdentifier map[string]map[*Connection]struct{}
+	// `<name>=<value>` -> connections, for the connections identified by Identifiers.
+	byIdentifiers map[string]map[*Connection]struct{}
+	mu            sync.RWMutex
+}
+
+// The details of a connection, see Connection.Info.
+type ConnectionInfo struct {
+	Identifier  any
+	SessionID   string
+	Protocol    string
+	ConnectedAt time.Time
+	// The messages waiting in the send queue, and the ones dropped by the overflow policy, see config.WithSendQueue.
+	QueuedMessages  int
+	DroppedMessages uint64
+	// Ordered by the channel names and the identifiers.
+	Subscriptions []SubscriptionInfo
+}
+
+type SubscriptionInfo struct {
+	Channel string
+	// E.g. `{"channel":"RoomChannel","id":1}`
+	Identifier string
+	// Ordered.
+	Streams []string
+}
+
+func newConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{
+		connections:   map[*Connection]struct{}{},
+		byIdentifier:  map[string]map[*Connection]struct{}{},
+		byIdentifiers: map[string]map[*Connection]struct{}{},
+	}
+}
+
+// Add the connection unless it's closed, e.g. by the client during Connection.Setup. It's checked holding r.mu,
+// so the connection closed afterwards is removed by Connection.close.
+func (r *ConnectionRegistry) add(conn *Connection) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conn.mu.Lock()
+	closed := conn.closed
+	conn.mu.Unlock()
+
+	if closed {
+		return false
+	}
+
+	r.connections[conn] = struct{}{}
+	addToIndex(r.byIdentifier, connectionGID(conn.identifier), conn)
+
+	for k, v := range conn.Identifiers() {
+		addToIndex(r.byIdentifiers, k+"="+v, conn)
+	}
+
+	return true
+}
+
+func (r *ConnectionRegistry) remove(conn *Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.connections[conn]; !ok {
+		return
+	}
+
+	delete(r.connections, conn)
+	removeFromIndex(r.byIdentifier, connectionGID(conn.identifier), conn)
+
+	for k, v := range conn.Identifiers() {
+		removeFromIndex(r.byIdentifiers, k+"="+v, conn)
+	}
+}
+
+// The number of the connections.
+func (r *ConnectionRegistry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.connections)
+}
+
+// The connections of the identifier. For Identifiers, it could be any subset of them, e.g.
+// `Identifiers{"current_account": "1"}` finds all the connections of the account.
+func (r *ConnectionRegistry) Lookup(identifier any) []*Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids, ok := identifier.(Identifiers)
+
+	if !ok {
+		return connectionsOf(r.byIdentifier[connectionGID(identifier)], nil)
+	}
+
+	if len(ids) == 0 {
+		return []*Connection{}
+	}
+
+	// Scan the smallest of the indexes of the identifiers.
+	var candidates map[*Connection]struct{}
+
+	for k, v := range ids {
+		index := r.byIdentifiers[k+"="+v]
+
+		if candidates == nil || len(index) < len(candidates) {
+			candidates = index
+		}
+	}
+
+	return connectionsOf(candidates, func(conn *Connection) bool { return conn.Identifiers().includes(ids) })
+}
+
+// The number of the connections of the identifier, see Lookup.
+func (r *ConnectionRegistry) CountFor(identifier any) int {
+	return len(r.Lookup(identifier))
+}
+
+// The connections the filter returns true for, all of them if the filter is nil. The filter must not close the
+// connections, close them after Select returns instead.
+func (r *ConnectionRegistry) Select(filter func(*Connection) bool) []*Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return connectionsOf(r.connections, filter)
+}
+
+func connectionsOf(set map[*Connection]struct{}, filter func(*Connection) bool) []*Connection {
+	conns := make([]*Connection, 0, len(set))
+
+	for conn := range set {
+		if filter == nil || filter(conn) {
+			conns = append(conns, conn)
+		}
+	}
+
+	return conns
+}
+
+func addToIndex(index map[string]map[*Connection]struct{}, key string, conn *Connection) {
+	if index[key] == nil {
+		index[key] = map[*Connection]struct{}{}
+	}
+
+	index[key][conn] = struct{}{}
+}
+
+func removeFromIndex(index map[string]map[*Connection]struct{}, key string, conn *Connection) {
+	delete(index[key], conn)
+
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// The details of the connection, e.g. its subscriptions and their streams.
+func (conn *Connection) Info() ConnectionInfo {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	info := ConnectionInfo{
+		Identifier:      conn.identifier,
+		SessionID:       conn.sid,
+		Protocol:        conn.protocol.name,
+		ConnectedAt:     conn.connectedAt,
+		QueuedMessages:  conn.send.len(),
+		DroppedMessages: conn.DroppedMessages(),
+		Subscriptions:   []SubscriptionInfo{},
+	}
+
+	for _, channels := range conn.channels {
+		for _, ch := range channels {
+			ch.mu.Lock()
+			sub := SubscriptionInfo{Channel: ch.Name, Identifier: ch.Identifier, Streams: make([]string, 0, len(ch.streams))}
+			for broadcasting := range ch.streams {
+				sub.Streams = append(sub.Streams, broadcasting)
+			}
+			ch.mu.Unlock()
+
+			sort.Strings(sub.Streams)
+			info.Subscriptions = append(info.Subscriptions, sub)
+		}
+	}
+
+	sort.Slice(info.Subscriptions, func(i, j int) bool {
+		a, b := info.Subscriptions[i], info.Subscriptions[j]
+
+		return a.Channel < b.Channel || (a.Channel == b.Channel && a.Identifier < b.Identifier)
+	})
+
+	return info
+}
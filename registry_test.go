@@ -0,0 +1,108 @@
+package actioncable
+
+import (
+	"testing"
+)
+
+func TestConnectionRegistry(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(c *Channel) { c.StreamFrom("room_1") },
+	})
+
+	connect := func(id any) (*Connection, *testWsConnection) {
+		_, ws := newTestConnection(id)
+
+		conn, _ := cable.connect(id, ws, &protocol{name: jsonProtocol, codec: JSONCodec{}}, nil)
+
+		return conn, ws
+	}
+
+	user1, ws := connect(Identifiers{"current_user": "1", "current_account": "a"})
+	connect(Identifiers{"current_user": "1", "current_account": "a"})
+	user2, _ := connect(Identifiers{"current_user": "2", "current_account": "a"})
+	legacy, _ := connect("user3")
+
+	if n := cable.Connections.Count(); n != 4 {
+		t.Errorf("Expected 4 connections, got %d", n)
+	}
+
+	for _, tc := range []struct {
+		identifier any
+		expected   int
+	}{
+		{Identifiers{"current_user": "1"}, 2},
+		{Identifiers{"current_account": "a"}, 3},
+		{Identifiers{"current_user": "2", "current_account": "a"}, 1},
+		{Identifiers{"current_user": "2", "current_account": "b"}, 0},
+		{Identifiers{"role": "admin"}, 0},
+		{Identifiers{}, 0},
+		{"user3", 1},
+		{"user4", 0},
+	} {
+		if n := cable.Connections.CountFor(tc.identifier); n != tc.expected {
+			t.Errorf("Expected %d connections of %v, got %d", tc.expected, tc.identifier, n)
+		}
+	}
+
+	if conns := cable.Connections.Select(func(c *Connection) bool { return c.Identifiers() == nil }); len(conns) != 1 || conns[0] != legacy {
+		t.Errorf("Unexpected connections selected: %v", conns)
+	}
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+
+	info := user1.Info()
+
+	if info.SessionID != user1.sid || info.Protocol != jsonProtocol || info.ConnectedAt.IsZero() {
+		t.Errorf("Unexpected connection info: %+v", info)
+	}
+
+	if len(info.Subscriptions) != 1 || info.Subscriptions[0].Channel != "RoomChannel" ||
+		len(info.Subscriptions[0].Streams) != 1 || info.Subscriptions[0].Streams[0] != "room_1" {
+		t.Errorf("Unexpected subscriptions: %+v", info.Subscriptions)
+	}
+
+	user2.Close("bye")
+	legacy.Close("bye")
+
+	if n := cable.Connections.CountFor(Identifiers{"current_account": "a"}); n != 2 {
+		t.Errorf("Expected 2 connections of the account, got %d", n)
+	}
+
+	if n := cable.Connections.CountFor("user3"); n != 0 || cable.Connections.Count() != 2 {
+		t.Error("The closed connections are not removed.")
+	}
+
+	if len(cable.Connections.byIdentifiers) != 2 || len(cable.Connections.byIdentifier) != 1 {
+		t.Errorf("The indexes are not cleaned up: %v, %v", cable.Connections.byIdentifiers, cable.Connections.byIdentifier)
+	}
+
+	for _, conn := range cable.Connections.Select(nil) {
+		conn.Close("test complete")
+	}
+}
+
+func TestConnectionRegistryClosedDuringSetup(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	// The client is gone before the connection is set up.
+	_, ws := newTestConnection("user1")
+	close(ws.clientClose)
+
+	conn, _ := cable.connect("user1", ws, &protocol{name: jsonProtocol, codec: JSONCodec{}}, nil)
+	<-conn.done
+
+	if n := cable.Connections.Count(); n != 0 {
+		t.Errorf("The closed connection is registered: %d", n)
+	}
+
+	if cable.Connections.add(conn) || cable.Connections.CountFor("user1") != 0 {
+		t.Error("The closed connection is added.")
+	}
+}
@@ -0,0 +1,257 @@
+package actioncable
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// What to do with the messages to a connection whose send queue is full, i.e. a client reading slower than the
+// messages are sent to it. The control messages (e.g. the welcome and the subscription confirmations) are never
+// dropped, they're queued beyond the size.
+type OverflowPolicy int
+
+const (
+	// Drop the oldest channel message (or ping) in the queue to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota + 1
+	// Drop the new channel message (or ping).
+	OverflowDropNewest
+	// Drop the queued broadcast of the same subscription and broadcasting as the new one, so the client catches up
+	// with the latest state of each broadcasting. The oldest channel message is dropped if there's none of them, or
+	// the new one is not a broadcast (e.g. Channel.Transmit).
+	OverflowCoalesce
+	// Close the connection with DisconnectSlowConsumer.
+	OverflowDisconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop oldest"
+	case OverflowDropNewest:
+		return "drop newest"
+	case OverflowCoalesce:
+		return "coalesce"
+	case OverflowDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// The messages waiting to be written to a connection. Queueing never blocks, so a slow client doesn't hold up
+// the broadcasts to the others.
+type sendQueue struct {
+	size     int
+	policy   OverflowPolicy
+	messages []any
+	// the messages handed to the writer directly while it's idle and nothing is queued.
+	direct chan any
+	// signaled (without blocking) when the messages are queued.
+	ready   chan struct{}
+	dropped uint64
+	mu      sync.Mutex
+}
+
+func newSendQueue(size int, policy OverflowPolicy) *sendQueue {
+	if size <= 0 {
+		size = 1
+	}
+
+	if policy == 0 {
+		policy = OverflowDropOldest
+	}
+
+	return &sendQueue{size: size, policy: policy, direct: make(chan any), ready: make(chan struct{}, 1)}
+}
+
+// Queue the message, returning false if the queue overflows with OverflowDisconnect.
+func (q *sendQueue) push(msg any) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.messages) == 0 {
+		select {
+		case q.direct <- msg:
+			return true
+		default:
+		}
+	}
+
+	if len(q.messages) >= q.size && droppable(msg) {
+		switch q.policy {
+		case OverflowDropNewest:
+			atomic.AddUint64(&q.dropped, 1)
+
+			return true
+		case OverflowDisconnect:
+			return false
+		case OverflowCoalesce:
+			if i := q.coalescing(msg); i >= 0 {
+				q.messages = append(q.messages[:i], q.messages[i+1:]...)
+				atomic.AddUint64(&q.dropped, 1)
+			} else {
+				q.dropOldest()
+			}
+		default:
+			q.dropOldest()
+		}
+	}
+
+	q.messages = append(q.messages, msg)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Take all the queued messages.
+func (q *sendQueue) pop() []any {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	messages := q.messages
+	q.messages = nil
+
+	return messages
+}
+
+// The number of the queued messages.
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.messages)
+}
+
+// Drop the oldest droppable message. It's called holding q.mu.
+func (q *sendQueue) dropOldest() {
+	for i, m := range q.messages {
+		if droppable(m) {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			atomic.AddUint64(&q.dropped, 1)
+
+			return
+		}
+	}
+}
+
+// The index of the queued broadcast the new one supersedes, or -1. It's called holding q.mu.
+func (q *sendQueue) coalescing(msg any) int {
+	f, ok := msg.(*preparedFrame)
+
+	if !ok {
+		return -1
+	}
+
+	for i := len(q.messages) - 1; i >= 0; i-- {
+		if queued, ok := q.messages[i].(*preparedFrame); ok && queued.message.Identifier == f.message.Identifier && queued.broadcasting == f.broadcasting {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Only the channel messages and the pings could be dropped.
+func droppable(msg any) bool {
+	if _, ok := msg.(*pingMessage); ok {
+		return true
+	}
+
+	_, ok := queuedChannelMessage(msg)
+
+	return ok
+}
+
+// The channel message queued as is, or as the frame of a broadcast.
+func queuedChannelMessage(msg any) (channelMessage, bool) {
+	switch m := msg.(type) {
+	case channelMessage:
+		return m, true
+	case *preparedFrame:
+		return m.message, true
+	default:
+		return channelMessage{}, false
+	}
+}
+
+// The number of the messages to the connection dropped by the overflow policy, see config.WithSendQueue.
+func (conn *Connection) DroppedMessages() uint64 {
+	return atomic.LoadUint64(&conn.send.dropped)
+}
+
+// Queue the message to be written to the client. The connection overflowing with OverflowDisconnect is closed.
+func (conn *Connection) enqueue(msg any) {
+	select {
+	case <-conn.done:
+		return
+	default:
+	}
+
+	if conn.send.push(msg) {
+		return
+	}
+
+	logger.Error(fmt.Sprintf("The send queue of %v is full (%d messages)", conn.identifier, conn.send.size))
+
+	// Closing unsubscribes the channels, which mustn't wait for the broadcast in progress.
+	go conn.close(DisconnectSlowConsumer, "slow consumer.")
+}
+
+// Implemented by the transports supporting the write deadlines, e.g. *websocket.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+func (conn *Connection) serveWriting() {
+	for {
+		select {
+		case <-conn.done:
+			return
+		case msg := <-conn.send.direct:
+			if !conn.writeQueued(msg) {
+				return
+			}
+		case <-conn.send.ready:
+			for _, msg := range conn.send.pop() {
+				if !conn.writeQueued(msg) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Write the message within the write timeout, returning false if it timed out and the connection is closed.
+func (conn *Connection) writeQueued(msg any) bool {
+	timeout := conn.cable.Config.writeTimeout
+
+	if d, ok := conn.wsConn.(writeDeadliner); ok && timeout > 0 {
+		d.SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	err := conn.writeMessage(msg)
+
+	if err == nil {
+		return true
+	}
+
+	logger.Error(fmt.Sprintf("Write message failed: %v", err))
+
+	var ne net.Error
+
+	if errors.As(err, &ne) && ne.Timeout() {
+		go conn.close(DisconnectSlowConsumer, "write timeout.")
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,212 @@
+package actioncable
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// A client which doesn't read: the writes block until released, or time out after the write deadline without
+// the release.
+type slowWsConnection struct {
+	*testWsConnection
+	release  chan struct{}
+	deadline time.Time
+}
+
+func (c *slowWsConnection) WriteJSON(j any) error {
+	if c.release == nil {
+		time.Sleep(time.Until(c.deadline))
+
+		return os.ErrDeadlineExceeded
+	}
+
+	<-c.release
+
+	return c.testWsConnection.WriteJSON(j)
+}
+
+func (c *slowWsConnection) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+
+	return nil
+}
+
+func queuedMessages(q *sendQueue) []string {
+	messages := []string{}
+
+	for _, m := range q.messages {
+		switch m := m.(type) {
+		case channelMessage:
+			messages = append(messages, m.Identifier+" "+m.Message.(string))
+		case *preparedFrame:
+			messages = append(messages, m.message.Identifier+" "+m.broadcasting+" "+m.message.Message.(string))
+		case map[string]string:
+			messages = append(messages, m["type"])
+		}
+	}
+
+	return messages
+}
+
+func TestSendQueueOverflowPolicies(t *testing.T) {
+	confirm := map[string]string{"type": "confirm_subscription"}
+	broadcast := func(identifier, broadcasting, message string) *preparedFrame {
+		return &preparedFrame{message: channelMessage{Identifier: identifier, Message: message}, broadcasting: broadcasting}
+	}
+	push := func(policy OverflowPolicy) (*sendQueue, bool) {
+		q := newSendQueue(2, policy)
+		ok := true
+
+		for _, m := range []any{
+			broadcast("a", "s1", "1"),
+			broadcast("b", "s1", "2"),
+			broadcast("a", "s1", "3"),
+			broadcast("a", "s2", "4"),
+			confirm,
+		} {
+			ok = q.push(m) && ok
+		}
+
+		return q, ok
+	}
+
+	expectations := map[OverflowPolicy][]string{
+		OverflowDropOldest: {"a s1 3", "a s2 4", "confirm_subscription"},
+		OverflowDropNewest: {"a s1 1", "b s1 2", "confirm_subscription"},
+		OverflowCoalesce:   {"a s1 3", "a s2 4", "confirm_subscription"},
+	}
+
+	for policy, expected := range expectations {
+		q, ok := push(policy)
+
+		if !ok {
+			t.Errorf("%v: Unexpected overflow.", policy)
+		}
+
+		if messages := queuedMessages(q); len(messages) != len(expected) || messages[0] != expected[0] || messages[1] != expected[1] || messages[2] != expected[2] {
+			t.Errorf("%v: Unexpected messages: %+v", policy, messages)
+		}
+
+		if q.dropped != 2 {
+			t.Errorf("%v: Unexpected dropped messages: %d", policy, q.dropped)
+		}
+	}
+
+	if _, ok := push(OverflowDisconnect); ok {
+		t.Error("OverflowDisconnect should overflow.")
+	}
+
+	// The transmitted messages don't coalesce with the broadcasts.
+	q := newSendQueue(2, OverflowCoalesce)
+	q.push(channelMessage{Identifier: "a", Message: "1"})
+	q.push(broadcast("a", "s1", "2"))
+	q.push(channelMessage{Identifier: "a", Message: "3"})
+
+	if messages := queuedMessages(q); len(messages) != 2 || messages[0] != "a s1 2" || messages[1] != "a 3" {
+		t.Errorf("Unexpected coalesced messages: %+v", messages)
+	}
+
+	// The control messages are queued beyond the size.
+	q = newSendQueue(1, OverflowDisconnect)
+
+	if !q.push(confirm) || !q.push(confirm) || len(q.messages) != 2 {
+		t.Errorf("Unexpected messages: %+v", q.messages)
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	slow := &slowWsConnection{testWsConnection: ws, release: make(chan struct{})}
+	conn.wsConn = slow
+	cable := conn.cable
+	cable.Config.WithSendQueue(2, OverflowDropOldest)
+	conn.send = newSendQueue(2, OverflowDropOldest)
+
+	reasons := make(chan DisconnectReason, 1)
+	cable.Config.WithOnDisconnect(func(_ *Connection, r DisconnectReason) { reasons <- r })
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(c *Channel) { c.StreamFrom("room_1") },
+	})
+
+	conn.Setup()
+	go func() { slow.release <- struct{}{} }() // the welcome
+	ws.write([]byte(`{"command":"subscribe","identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	go func() { slow.release <- struct{}{} }() // the confirmation
+	time.Sleep(5 * time.Millisecond)
+
+	// The writer is blocked on the first message, the others are queued without blocking the broadcasts.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		cable.Broadcast("RoomChannel", "room_1", i)
+		time.Sleep(time.Millisecond)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("The broadcasts are blocked for %v", elapsed)
+	}
+
+	if info := conn.Info(); info.QueuedMessages != 2 || info.DroppedMessages != 2 {
+		t.Errorf("Unexpected queue: %+v", info)
+	}
+
+	for i := 0; i < 3; i++ {
+		slow.release <- struct{}{}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if m := lastMessageJSON(ws); m != `{"identifier":"{\"channel\":\"RoomChannel\"}","message":4}` {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	// Overflowing with OverflowDisconnect.
+	conn.send.policy = OverflowDisconnect
+	for i := 0; i < 4; i++ {
+		cable.Broadcast("RoomChannel", "room_1", i)
+		time.Sleep(time.Millisecond)
+	}
+
+	if conn.DroppedMessages() != 2 {
+		t.Errorf("Unexpected dropped messages: %d", conn.DroppedMessages())
+	}
+
+	close(slow.release)
+
+	select {
+	case r := <-reasons:
+		if r != DisconnectSlowConsumer {
+			t.Errorf("Unexpected disconnect reason: %v", r)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("The slow consumer is not disconnected.")
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	conn.wsConn = &slowWsConnection{testWsConnection: ws}
+	cable := conn.cable
+	cable.Config.WithWriteTimeout(10 * time.Millisecond)
+
+	reasons := make(chan DisconnectReason, 1)
+	cable.Config.WithOnDisconnect(func(_ *Connection, r DisconnectReason) { reasons <- r })
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	conn.Setup()
+
+	select {
+	case r := <-reasons:
+		if r != DisconnectSlowConsumer {
+			t.Errorf("Unexpected disconnect reason: %v", r)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("The connection is not closed after the write timeout.")
+	}
+}
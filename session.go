@@ -0,0 +1,298 @@
+package actioncable
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The state of a connection kept after it's closed, so a client reconnecting with the restore token (the
+// `restore_token` of the welcome message) within the restoration window gets it back without the Subscribed
+// callbacks re-run. The session is only restored to the connection authenticated with the same identifier.
+type Session struct {
+	// The connection identifier. NOTE: it's JSON decoded if the store serializes the sessions, e.g. RedisSessionStore,
+	// so the identifiers other than strings, numbers and Identifiers may not match the authenticated ones.
+	Identifier any `json:"identifier"`
+	// The connection identifiers if the authenticator returns Identifiers, which survive the JSON round trip.
+	Identifiers   Identifiers           `json:"identifiers,omitempty"`
+	Subscriptions []SessionSubscription `json:"subscriptions"`
+}
+
+// The connection identifier the session belongs to.
+func (s *Session) identifier() any {
+	if s.Identifiers != nil {
+		return s.Identifiers
+	}
+
+	return s.Identifier
+}
+
+type SessionSubscription struct {
+	// E.g. `{"channel":"RoomChannel","id":1}`
+	Identifier string   `json:"identifier"`
+	Streams    []string `json:"streams"`
+	// The broadcastings joined the presence of, with the info of the member.
+	Presences map[string]json.RawMessage `json:"presences,omitempty"`
+	// The broadcasting the subscriber whispers to, see Channel.WhisperTo.
+	WhisperTo string `json:"whisper_to,omitempty"`
+}
+
+// The sessions are keyed by the restore tokens of the connections.
+type SessionStore interface {
+	Save(token string, session *Session, ttl time.Duration) error
+	// Fetch and remove the session, so it's restored once. It returns nil if the session doesn't exist or expired.
+	Take(token string) (*Session, error)
+}
+
+// A SessionStore in the process memory. It only suits the applications running on a single node.
+type MemorySessionStore struct {
+	sessions map[string]*memorySession
+	mu       sync.Mutex
+}
+
+type memorySession struct {
+	session   *Session
+	expiresAt time.Time
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]*memorySession{}}
+}
+
+func (s *MemorySessionStore) Save(sid string, session *Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for id, ms := range s.sessions {
+		if now.After(ms.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+
+	s.sessions[sid] = &memorySession{session: session, expiresAt: now.Add(ttl)}
+
+	return nil
+}
+
+func (s *MemorySessionStore) Take(sid string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, ok := s.sessions[sid]
+
+	if !ok {
+		return nil, nil
+	}
+
+	delete(s.sessions, sid)
+
+	if time.Now().After(ms.expiresAt) {
+		return nil, nil
+	}
+
+	return ms.session, nil
+}
+
+// A SessionStore with Redis backend, so the sessions could be restored on any node.
+type RedisSessionStore struct {
+	Client *redis.Client
+}
+
+var _ SessionStore = (*RedisSessionStore)(nil)
+
+const redisSessionPrefix = "_action_cable_session/"
+
+func (s *RedisSessionStore) Save(sid string, session *Session, ttl time.Duration) error {
+	b, err := json.Marshal(session)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Client.Set(context.TODO(), redisSessionPrefix+sid, b, ttl).Err()
+}
+
+func (s *RedisSessionStore) Take(sid string) (*Session, error) {
+	ctx := context.TODO()
+	key := redisSessionPrefix + sid
+
+	var get *redis.StringCmd
+	_, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+
+		return nil
+	})
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+
+	if err := json.Unmarshal([]byte(get.Val()), session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Take the session presented by the reconnecting client authenticated with the identifier, if any.
+func (cb *Cable) takeSession(token string, identifier any) *Session {
+	if !cb.Config.sessionRestoration() || token == "" {
+		return nil
+	}
+
+	session, err := cb.Config.sessions.Take(token)
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("Fetch session failed: %v", err))
+
+		return nil
+	}
+
+	if session != nil && identityKey(session.identifier()) != identityKey(identifier) {
+		logger.Info(fmt.Sprintf("The session of %v is not restored to %v", session.identifier(), identifier))
+
+		return nil
+	}
+
+	return session
+}
+
+// Keep the session of the closed connection for the restoration window.
+func (conn *Connection) saveSession() {
+	if !conn.cable.Config.sessionRestoration() {
+		return
+	}
+
+	session := &Session{Identifier: conn.identifier, Identifiers: conn.Identifiers()}
+
+	conn.mu.Lock()
+	for _, channels := range conn.channels {
+		for _, ch := range channels {
+			ch.mu.Lock()
+			// The stream callbacks and the timers of Every can't be kept, the client subscribes again instead.
+			if len(ch.streamHandlers) > 0 || ch.everyCalled {
+				ch.mu.Unlock()
+
+				continue
+			}
+
+			sub := SessionSubscription{
+				Identifier: ch.Identifier,
+				Streams:    make([]string, 0, len(ch.streams)),
+				WhisperTo:  ch.whisperTo,
+			}
+			for broadcasting := range ch.streams {
+				sub.Streams = append(sub.Streams, broadcasting)
+			}
+			for broadcasting, info := range ch.presences {
+				if sub.Presences == nil {
+					sub.Presences = map[string]json.RawMessage{}
+				}
+				sub.Presences[broadcasting] = info
+			}
+			ch.mu.Unlock()
+
+			session.Subscriptions = append(session.Subscriptions, sub)
+		}
+	}
+	conn.mu.Unlock()
+
+	if err := conn.cable.Config.sessions.Save(conn.restoreToken, session, conn.cable.Config.sessionWindow); err != nil {
+		logger.Error(fmt.Sprintf("Save session %s failed: %v", conn.sid, err))
+	}
+}
+
+// A subscription restored from a session, whose streams and presences are resumed after the welcome message.
+type restoredSubscription struct {
+	channel *Channel
+	sub     SessionSubscription
+}
+
+// Restore the subscriptions of the session, without streaming from their broadcastings yet.
+// It's called by Setup (holding conn.mu) before the connection starts reading.
+func (conn *Connection) restoreSubscriptions(session *Session) []restoredSubscription {
+	restored := []restoredSubscription{}
+
+	for _, sub := range session.Subscriptions {
+		c := struct {
+			ChannelName string `json:"channel"`
+		}{}
+
+		if err := json.Unmarshal([]byte(sub.Identifier), &c); err != nil {
+			logger.Error(fmt.Sprintf("Can't decode identifier %s, %v", sub.Identifier, err))
+
+			continue
+		}
+
+		cd, ok := conn.cable.channelDescriptions[c.ChannelName]
+
+		if !ok {
+			logger.Error("restoreSubscriptions failed: Channel not found: " + c.ChannelName)
+
+			continue
+		}
+
+		ch := newChannel(conn, sub.Identifier, json.RawMessage(sub.Identifier), cd, defaultOnBroadcast)
+		ch.isConfirmationSent = true
+		ch.whisperTo = sub.WhisperTo
+
+		if conn.channels[c.ChannelName] == nil {
+			conn.channels[c.ChannelName] = map[string]*Channel{}
+		}
+		conn.channels[c.ChannelName][ch.Identifier] = ch
+
+		restored = append(restored, restoredSubscription{channel: ch, sub: sub})
+	}
+
+	return restored
+}
+
+// Stream from the broadcastings of the restored subscriptions, join their presences and start their timers.
+// It's called by Setup (holding conn.mu) after the welcome message is queued, so their messages follow it.
+func (conn *Connection) resumeSubscriptions(restored []restoredSubscription) {
+	for _, r := range restored {
+		ch := r.channel
+		ch.startTimers()
+
+		for _, broadcasting := range r.sub.Streams {
+			if err := ch.pubsub.Subscribe(ch, broadcasting); err != nil {
+				logger.Error(fmt.Sprintf("Subscribe %s failed due to: %s", broadcasting, err.Error()))
+
+				continue
+			}
+
+			ch.mu.Lock()
+			ch.streams[broadcasting] = struct{}{}
+			ch.mu.Unlock()
+		}
+
+		for broadcasting, info := range r.sub.Presences {
+			var err error
+
+			if len(info) == 0 {
+				err = ch.JoinPresence(broadcasting, nil)
+			} else {
+				err = ch.JoinPresence(broadcasting, info)
+			}
+
+			if err != nil {
+				logger.Error(fmt.Sprintf("Join the presence of %s failed: %v", broadcasting, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	session := &Session{Identifier: "user1"}
+
+	store.Save("sid1", session, time.Minute)
+	store.Save("sid2", session, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	if s, _ := store.Take("sid1"); s != session {
+		t.Errorf("Unexpected session: %+v", s)
+	}
+
+	if s, _ := store.Take("sid1"); s != nil {
+		t.Error("The session is restored twice.")
+	}
+
+	if s, _ := store.Take("sid2"); s != nil {
+		t.Error("The expired session is restored.")
+	}
+}
+
+func TestSessionRestoration(t *testing.T) {
+	cable := newTestCable()
+	cable.Config.WithSessionRestoration(time.Minute).WithSessionStore(NewMemorySessionStore())
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	authenticated := 0
+	cable.Config.WithAuthenticator(func(r *http.Request) (any, bool) {
+		authenticated++
+
+		if user := r.URL.Query().Get("user"); user != "" {
+			return user, true
+		}
+
+		return "user1", true
+	})
+
+	subscribed := 0
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			subscribed++
+			c.StreamFrom("room_1")
+		},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cable.Handle(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dialer := &websocket.Dialer{Subprotocols: []string{jsonProtocol}}
+
+	ws, _, err := dialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	welcome := &welcomeMessage{}
+	ws.ReadJSON(welcome)
+
+	if welcome.Sid == "" || welcome.RestoreToken == "" || welcome.RestoreToken == welcome.Sid || welcome.Restored {
+		t.Errorf("Unexpected welcome message: %+v", welcome)
+	}
+
+	ws.WriteJSON(&command{Command: "subscribe", Identifier: `{"channel":"RoomChannel"}`})
+	ws.ReadJSON(&map[string]string{})
+	ws.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	ws, _, err = dialer.Dial(url+"?restore_token="+welcome.RestoreToken, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	restored := &welcomeMessage{}
+	ws.ReadJSON(restored)
+
+	if !restored.Restored || len(restored.RestoredIDs) != 1 || restored.RestoredIDs[0] != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected welcome message: %+v", restored)
+	}
+
+	if restored.Sid == "" || restored.Sid == welcome.Sid || restored.RestoreToken == welcome.RestoreToken {
+		t.Errorf("Unexpected session ID: %s", restored.Sid)
+	}
+
+	if authenticated != 2 || subscribed != 1 {
+		t.Errorf("Authenticated %d times, subscribed %d times.", authenticated, subscribed)
+	}
+
+	cable.Broadcast("RoomChannel", "room_1", "hello")
+
+	m := map[string]any{}
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	ws.ReadJSON(&m)
+
+	if m["identifier"] != `{"channel":"RoomChannel"}` || m["message"] != "hello" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+
+	// The session isn't restored to the other identifier.
+	ws.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	ws, _, err = dialer.Dial(url+"?user=user2&restore_token="+restored.RestoreToken, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	other := &welcomeMessage{}
+	ws.ReadJSON(other)
+
+	if other.Restored || len(other.RestoredIDs) != 0 {
+		t.Errorf("The session is restored to the other identifier: %+v", other)
+	}
+}
+
+func TestSessionRestorationWindow(t *testing.T) {
+	conn, _ := newTestConnection("user1")
+	store := NewMemorySessionStore()
+	conn.cable.Config.WithSessionStore(store)
+
+	conn.Setup()
+	conn.close(DisconnectClientClosed, "bye")
+
+	if s, _ := store.Take(conn.restoreToken); s != nil {
+		t.Errorf("The session is kept without the window: %+v", s)
+	}
+}
+
+func TestRemoteDisconnectDiscardsSession(t *testing.T) {
+	conn, _ := newTestConnection("user1")
+	store := NewMemorySessionStore()
+	conn.cable.Config.WithSessionRestoration(time.Minute).WithSessionStore(store)
+
+	conn.Setup()
+	conn.Close("close by remote.")
+
+	if s, _ := store.Take(conn.restoreToken); s != nil {
+		t.Errorf("Unexpected session: %+v", s)
+	}
+}
+
+func TestSessionSkipsStreamCallbacksAndTimers(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+	store := NewMemorySessionStore()
+	cable.Config.WithSessionRestoration(time.Minute).WithSessionStore(store)
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:       "RoomChannel",
+		Subscribed: func(c *Channel) { c.StreamFrom("room_1") },
+	})
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "SecretChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFromWith("secrets", func(c *Channel, message any) {}, nil)
+		},
+	})
+	// The timers of Every are not restored either.
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "ClockChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFrom("clock")
+			c.Every(time.Minute, func(c *Channel) {})
+		},
+	})
+
+	conn.Setup()
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"SecretChannel\"}"}`))
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"ClockChannel\"}"}`))
+	conn.close(DisconnectClientClosed, "bye")
+
+	session, _ := store.Take(conn.restoreToken)
+
+	if session == nil || len(session.Subscriptions) != 1 || session.Subscriptions[0].Identifier != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected session: %+v", session)
+	}
+}
+
+// A PubSub closing its client on Stop, like RedisPubSub does.
+type closingPubSub struct {
+	PubSub
+	stopped bool
+	mu      sync.Mutex
+}
+
+func (p *closingPubSub) Stop() error {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+
+	return p.PubSub.Stop()
+}
+
+// A SessionStore sharing the client of the closingPubSub.
+type sharedClientSessionStore struct {
+	*MemorySessionStore
+	pubsub *closingPubSub
+}
+
+func (s *sharedClientSessionStore) Save(token string, session *Session, ttl time.Duration) error {
+	s.pubsub.mu.Lock()
+	defer s.pubsub.mu.Unlock()
+
+	if s.pubsub.stopped {
+		return errors.New("client is closed")
+	}
+
+	return s.MemorySessionStore.Save(token, session, ttl)
+}
+
+func TestStopSavesSessions(t *testing.T) {
+	cable := newTestCable()
+	pubsub := &closingPubSub{PubSub: cable.PubSub}
+	cable.PubSub = pubsub
+	store := &sharedClientSessionStore{MemorySessionStore: NewMemorySessionStore(), pubsub: pubsub}
+	cable.Config.WithSessionRestoration(time.Minute).WithSessionStore(store)
+
+	cable.PubSub.Run()
+
+	_, ws := newTestConnection("user1")
+	conn, _ := cable.connect("user1", ws, &protocol{name: jsonProtocol, codec: JSONCodec{}}, nil)
+
+	cable.Stop()
+
+	if s, _ := store.Take(conn.restoreToken); s == nil {
+		t.Error("The session is not saved on the shutdown.")
+	}
+}
+
+func TestSessionKeepsWhispers(t *testing.T) {
+	conn1, ws1 := newTestConnection("user1")
+	conn2, ws2 := newTestConnection("user2")
+	cable := conn1.cable
+	conn2.cable = cable
+	store := NewMemorySessionStore()
+	cable.Config.WithSessionRestoration(time.Minute).WithSessionStore(store)
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFrom("room_1")
+			c.WhisperTo("room_1")
+		},
+	})
+
+	data := `{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`
+
+	conn1.Setup()
+	ws1.write([]byte(data))
+	conn1.close(DisconnectClientClosed, "bye")
+
+	session, _ := store.Take(conn1.restoreToken)
+
+	if session == nil || len(session.Subscriptions) != 1 || session.Subscriptions[0].WhisperTo != "room_1" {
+		t.Fatalf("Unexpected session: %+v", session)
+	}
+
+	restored, ws := newTestConnection("user1")
+	restored.cable = cable
+	restored.session = session
+	restored.Setup()
+	defer restored.Close("test complete")
+
+	conn2.Setup()
+	defer conn2.Close("test complete")
+	ws2.write([]byte(data))
+	ws2.waitMessages(t, 2)
+
+	// The restored subscriber still whispers.
+	ws.write([]byte(`{"command":"whisper", "identifier":"{\"channel\":\"RoomChannel\"}", "data":"{\"event\":\"typing\"}"}`))
+	ws2.waitMessages(t, 3)
+
+	if cm, ok := ws2.lastMessage().(channelMessage); !ok || cm.Message.(map[string]any)["event"] != "typing" {
+		t.Errorf("Unexpected message: %+v", ws2.lastMessage())
+	}
+}
+
+// A PubSub delivering the broadcasts before Broadcast returns.
+type syncPubSub struct {
+	*SubscriberMap
+}
+
+func (p *syncPubSub) Broadcast(channelName, broadcasting string, message []byte) error {
+	for _, c := range p.subscribers(channelName, broadcasting) {
+		c.onBroadcast(c, newBroadcastMessage(channelName, broadcasting, message))
+	}
+
+	return nil
+}
+
+func TestRestoredSessionWelcomesFirst(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+	cable.PubSub = struct{ PubSub }{&syncPubSub{&SubscriberMap{}}}
+	cable.Config.WithPresence(NewMemoryPresence(), time.Minute)
+
+	cable.PubSub.Run()
+	defer cable.Stop()
+
+	cable.RegisterChannel(&ChannelDescription{Name: "RoomChannel"})
+
+	conn.session = &Session{Identifier: "user1", Subscriptions: []SessionSubscription{{
+		Identifier: `{"channel":"RoomChannel"}`,
+		Streams:    []string{"room_1"},
+		Presences:  map[string]json.RawMessage{"room_1": nil},
+	}}}
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	// The presence join of the restored subscription follows the welcome.
+	ws.waitMessages(t, 2)
+
+	if m, ok := ws.messages()[0].(*welcomeMessage); !ok || !m.Restored {
+		t.Errorf("Unexpected first message: %+v", ws.messages()[0])
+	}
+
+	if cm, ok := ws.messages()[1].(channelMessage); !ok || cm.Identifier != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected presence message: %+v", ws.messages()[1])
+	}
+}
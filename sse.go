@@ -0,0 +1,208 @@
+package actioncable
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Returned by Cable.HandleSSE when the client connection is rejected.
+var ErrSSERejected = errors.New("actioncable: server-sent events connection rejected")
+
+var errSSEClosed = errors.New("actioncable: server-sent events stream is closed")
+
+var sseProtocol = &protocol{name: "actioncable-v1-sse", codec: JSONCodec{}}
+
+// The Server-Sent Events transport. The frames are written as `data` events of the stream, while the
+// commands come from the request only: the client declares its subscriptions when connecting.
+type sseConn struct {
+	w        io.Writer
+	flusher  http.Flusher
+	ctx      context.Context
+	commands chan []byte
+	done     chan struct{}
+	closed   bool
+	mu       sync.Mutex
+}
+
+var _ IConn = (*sseConn)(nil)
+
+func newSSEConn(w http.ResponseWriter, r *http.Request, commands [][]byte) *sseConn {
+	c := &sseConn{
+		w:        w,
+		flusher:  w.(http.Flusher),
+		ctx:      r.Context(),
+		commands: make(chan []byte, len(commands)),
+		done:     make(chan struct{}),
+	}
+
+	for _, cmd := range commands {
+		c.commands <- cmd
+	}
+
+	return c
+}
+
+func (c *sseConn) WriteJSON(v any) error {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return c.WriteMessage(sseProtocol.codec.FrameType(), b)
+}
+
+func (c *sseConn) WriteMessage(_ int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errSSEClosed
+	}
+
+	if _, err := fmt.Fprintf(c.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+
+	c.flusher.Flush()
+
+	return nil
+}
+
+// Return the commands declared by the client, then block until the client goes away.
+func (c *sseConn) ReadMessage() (int, []byte, error) {
+	select {
+	case cmd := <-c.commands:
+		return sseProtocol.codec.FrameType(), cmd, nil
+	default:
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return 0, nil, c.ctx.Err()
+	case <-c.done:
+		return 0, nil, errSSEClosed
+	}
+}
+
+func (c *sseConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+
+	return nil
+}
+
+// Handle a Server-Sent Events connection, the fallback for the clients which can't open a WebSocket.
+// The client declares its subscriptions by `identifier` URL parameters (e.g. `{"channel":"RoomChannel","id":1}`),
+// `channel` URL parameters (shortcut for the identifiers without params), or POSTing the subscribe commands
+// separated by newlines. It blocks until the connection is closed.
+func (cb *Cable) HandleSSE(w http.ResponseWriter, r *http.Request) error {
+	cfg := cb.Config
+
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+
+		return fmt.Errorf("%w: %T is not a http.Flusher", ErrSSERejected, w)
+	}
+
+	if !checkOrigin(cfg.allowedOrigins)(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+
+		return fmt.Errorf("%w: origin not allowed", ErrSSERejected)
+	}
+
+	commands, err := sseCommands(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return fmt.Errorf("%w: %v", ErrSSERejected, err)
+	}
+
+	id, pass := cfg.authenticator(r)
+
+	if !pass {
+		logger.Info("An unauthorized connection attempt was rejected.")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		cb.notifyUnauthorized(nil, sseProtocol)
+
+		return fmt.Errorf("%w: unauthorized", ErrSSERejected)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	transport := newSSEConn(w, r, commands)
+
+	if _, err := cb.connect(id, transport, sseProtocol, nil); err != nil {
+		return fmt.Errorf("%w: %v", ErrSSERejected, err)
+	}
+
+	logger.Info("Successfully opened a server-sent events stream.")
+
+	<-transport.done
+
+	return nil
+}
+
+// The commands declared by the client.
+func sseCommands(r *http.Request) ([][]byte, error) {
+	commands := [][]byte{}
+	query := r.URL.Query()
+	identifiers := query["identifier"]
+
+	for _, channel := range query["channel"] {
+		identifier, _ := json.Marshal(map[string]string{"channel": channel})
+		identifiers = append(identifiers, string(identifier))
+	}
+
+	for _, identifier := range identifiers {
+		cmd, _ := json.Marshal(&command{Command: "subscribe", Identifier: identifier})
+		commands = append(commands, cmd)
+	}
+
+	if r.Method != http.MethodPost {
+		return commands, nil
+	}
+
+	posted, err := readCommands(r.Body)
+
+	return append(commands, posted...), err
+}
+
+// Read the commands separated by newlines.
+func readCommands(body io.Reader) ([][]byte, error) {
+	commands := [][]byte{}
+	scanner := bufio.NewScanner(body)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("malformed command: %s", line)
+		}
+
+		commands = append(commands, append([]byte(nil), line...))
+	}
+
+	return commands, scanner.Err()
+}
@@ -0,0 +1,146 @@
+package actioncable
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readSSEEvent(t *testing.T, r *bufio.Reader) map[string]any {
+	line, err := r.ReadString('\n')
+
+	if err != nil {
+		t.Fatalf("Can't read event: %v", err)
+	}
+
+	r.ReadString('\n') // the blank line ending the event.
+
+	m := map[string]any{}
+
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &m); err != nil {
+		t.Fatalf("Can't decode event %q: %v", line, err)
+	}
+
+	return m
+}
+
+func TestHandleSSE(t *testing.T) {
+	cable := newTestCable()
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	unsubscribed := make(chan struct{}, 1)
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name:         "RoomChannel",
+		Subscribed:   func(c *Channel) { c.StreamFrom("room_1") },
+		Unsubscribed: func(c *Channel) { unsubscribed <- struct{}{} },
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cable.HandleSSE(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?channel=RoomChannel", nil)
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	body := bufio.NewReader(resp.Body)
+
+	if m := readSSEEvent(t, body); m["type"] != "welcome" {
+		t.Errorf("Unexpected welcome message: %+v", m)
+	}
+
+	if m := readSSEEvent(t, body); m["type"] != "confirm_subscription" || m["identifier"] != `{"channel":"RoomChannel"}` {
+		t.Errorf("Unexpected confirm message: %+v", m)
+	}
+
+	cable.Broadcast("RoomChannel", "room_1", "hello")
+
+	if m := readSSEEvent(t, body); m["identifier"] != `{"channel":"RoomChannel"}` || m["message"] != "hello" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+
+	cancel()
+
+	select {
+	case <-unsubscribed:
+	case <-time.After(time.Second):
+		t.Error("The subscription is not removed after the client goes away.")
+	}
+}
+
+func TestHandleSSEPostedCommands(t *testing.T) {
+	cable := newTestCable()
+
+	cable.RegisterChannel(&ChannelDescription{Name: "RoomChannel"})
+	cable.RegisterChannel(&ChannelDescription{Name: "ChatChannel"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cable.HandleSSE(w, r)
+	}))
+	defer server.Close()
+
+	body := `{"command":"subscribe","identifier":"{\"channel\":\"RoomChannel\",\"id\":1}"}
+{"command":"subscribe","identifier":"{\"channel\":\"ChatChannel\"}"}`
+
+	resp, err := http.Post(server.URL, "application/x-ndjson", strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	readSSEEvent(t, r)
+
+	for _, identifier := range []string{`{"channel":"RoomChannel","id":1}`, `{"channel":"ChatChannel"}`} {
+		if m := readSSEEvent(t, r); m["type"] != "confirm_subscription" || m["identifier"] != identifier {
+			t.Errorf("Unexpected confirm message: %+v", m)
+		}
+	}
+
+	resp, _ = http.Post(server.URL, "application/x-ndjson", strings.NewReader("not a command"))
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected status: %d", resp.StatusCode)
+	}
+}
+
+func TestHandleSSEUnauthorized(t *testing.T) {
+	cable := newTestCable()
+	cable.Config.WithAuthenticator(func(*http.Request) (any, bool) { return nil, false })
+
+	// The rejected connection passed to the hook is safe to use.
+	var info ConnectionInfo
+	cable.Config.WithOnDisconnect(func(c *Connection, r DisconnectReason) {
+		c.Close("unauthorized")
+		info = c.Info()
+	})
+
+	w := httptest.NewRecorder()
+	err := cable.HandleSSE(w, httptest.NewRequest(http.MethodGet, "/cable?channel=RoomChannel", nil))
+
+	if err == nil || w.Code != http.StatusUnauthorized {
+		t.Errorf("The unauthorized connection is not rejected: %d, %v", w.Code, err)
+	}
+
+	if info.Identifier != nil || info.SessionID != "" || info.Protocol != sseProtocol.name || len(info.Subscriptions) != 0 {
+		t.Errorf("Unexpected connection info: %+v", info)
+	}
+}
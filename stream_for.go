@@ -0,0 +1,73 @@
+package actioncable
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// An entity the broadcastings are derived from, see Channel.StreamFor and Cable.BroadcastTo.
+// ToBroadcasting returns the part identifying the entity, e.g. the GlobalID param of a Rails model.
+type Broadcastable interface {
+	ToBroadcasting() string
+}
+
+// The GlobalID of an entity, e.g. `gid://app/Room/1`, as the Rails models are identified in the broadcastings.
+type GlobalID struct {
+	App   string
+	Model string
+	ID    any
+}
+
+var _ Broadcastable = GlobalID{}
+
+func (gid GlobalID) String() string {
+	return fmt.Sprintf("gid://%s/%s/%v", gid.App, gid.Model, gid.ID)
+}
+
+// The GlobalID param, i.e. `to_gid_param` of Rails.
+func (gid GlobalID) ToBroadcasting() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(gid.String()))
+}
+
+// The broadcasting of the entity in the channel, the same as `broadcasting_for` of Rails: `<channel_name>:<entity>`,
+// where the channel name is underscored without the `Channel` suffix, e.g. `room:Z2lkOi8vYXBwL1Jvb20vMQ` for the
+// GlobalID{App: "app", Model: "Room", ID: 1} in RoomChannel. The entities which are not Broadcastable are
+// formatted by `%v`.
+func BroadcastingFor(channelName string, entity any) string {
+	var param string
+
+	if b, ok := entity.(Broadcastable); ok {
+		param = b.ToBroadcasting()
+	} else {
+		param = fmt.Sprintf("%v", entity)
+	}
+
+	return railsChannelName(channelName) + ":" + param
+}
+
+// E.g. RoomChannel -> room, Chat::RoomChannel -> chat:room
+func railsChannelName(name string) string {
+	parts := strings.Split(strings.TrimSuffix(name, "Channel"), "::")
+
+	for i, part := range parts {
+		parts[i] = snakeCase(part)
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// Start streaming from the broadcasting of the entity, see BroadcastingFor.
+func (c *Channel) StreamFor(entity any) {
+	c.StreamFrom(BroadcastingFor(c.Name, entity))
+}
+
+// Stop streaming from the broadcasting of the entity.
+func (c *Channel) StopStreamFor(entity any) {
+	c.StopStreamFrom(BroadcastingFor(c.Name, entity))
+}
+
+// Broadcast the message (JSON encoded) to the subscribers streaming for the entity in the channel.
+func (cb *Cable) BroadcastTo(channelName string, entity any, message any) error {
+	return cb.Broadcast(channelName, BroadcastingFor(channelName, entity), message)
+}
@@ -0,0 +1,66 @@
+package actioncable
+
+import (
+	"testing"
+	"time"
+)
+
+type testRoom struct {
+	ID int
+}
+
+func (r *testRoom) ToBroadcasting() string {
+	return GlobalID{App: "app", Model: "Room", ID: r.ID}.ToBroadcasting()
+}
+
+func TestBroadcastingFor(t *testing.T) {
+	for _, tc := range []struct {
+		channelName string
+		entity      any
+		expected    string
+	}{
+		{"RoomChannel", &testRoom{ID: 1}, "room:Z2lkOi8vYXBwL1Jvb20vMQ"},
+		{"Chat::RoomChannel", GlobalID{App: "app", Model: "User", ID: "42"}, "chat:room:Z2lkOi8vYXBwL1VzZXIvNDI"},
+		{"AppearanceChannel", 42, "appearance:42"},
+		{"Notifications", "user_1", "notifications:user_1"},
+	} {
+		if b := BroadcastingFor(tc.channelName, tc.entity); b != tc.expected {
+			t.Errorf("BroadcastingFor(%s, %v) = %s, expected %s", tc.channelName, tc.entity, b, tc.expected)
+		}
+	}
+}
+
+func TestStreamFor(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.StreamFor(&testRoom{ID: 1})
+		},
+	})
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	sent := len(ws.messages())
+
+	cable.BroadcastTo("RoomChannel", &testRoom{ID: 2}, map[string]string{"message": "other room"})
+	cable.BroadcastTo("RoomChannel", &testRoom{ID: 1}, map[string]string{"message": "hello"})
+	time.Sleep(5 * time.Millisecond)
+
+	if len(ws.messages()) != sent+1 {
+		t.Fatalf("Unexpected messages: %+v", ws.messages()[sent:])
+	}
+
+	if cm, ok := ws.messages()[sent].(channelMessage); !ok {
+		t.Errorf("Unexpected message: %+v", ws.messages()[sent])
+	} else if m, ok := cm.Message.(map[string]any); !ok || m["message"] != "hello" {
+		t.Errorf("Unexpected message: %+v", cm.Message)
+	}
+}
@@ -5,21 +5,43 @@ import (
 	"sync"
 )
 
+// The subscribers are sharded by the broadcastings, so the subscriptions and the broadcasts of the different
+// broadcastings rarely contend on a lock.
+const subscriberShards = 64
+
 type SubscriberMap struct {
 	broadcastConcurrentNum int
 	done                   chan struct{}
 	sending                chan *envelope
-	// Key hierarchy ChannelName -> Broadcasting
-	subscribers map[string]map[string]map[*Channel]struct{}
-	mu          sync.Mutex
+	shards                 [subscriberShards]subscriberShard
+}
+
+type subscriberShard struct {
+	subscribers map[subscriberKey]*subscriberSet
+	mu          sync.RWMutex
+}
+
+type subscriberKey struct {
+	channelName  string
+	broadcasting string
+}
+
+// The subscribers of a broadcasting. The broadcasts iterate the snapshot, which is rebuilt by the first broadcast
+// after the subscribers change, so they never iterate the map being changed.
+type subscriberSet struct {
+	channels map[*Channel]struct{}
+	snapshot []*Channel
 }
 
 type envelope struct {
 	receiver *Channel
-	message  []byte
+	message  *broadcastMessage
 }
 
-var _ PubSub = (*SubscriberMap)(nil)
+var (
+	_ PubSub           = (*SubscriberMap)(nil)
+	_ messagePublisher = (*SubscriberMap)(nil)
+)
 
 func (sm *SubscriberMap) Run() error {
 	if sm.broadcastConcurrentNum == 0 {
@@ -60,48 +82,54 @@ func (sm *SubscriberMap) Stop() error {
 }
 
 func (sm *SubscriberMap) Subscribe(c *Channel, broadcasting string) (err error) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	key := subscriberKey{channelName: c.Name, broadcasting: broadcasting}
+	shard := sm.shard(broadcasting)
 
-	if sm.subscribers == nil {
-		sm.subscribers = map[string]map[string]map[*Channel]struct{}{}
-	}
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	if sm.subscribers[c.Name] == nil {
-		sm.subscribers[c.Name] = map[string]map[*Channel]struct{}{}
+	if shard.subscribers == nil {
+		shard.subscribers = map[subscriberKey]*subscriberSet{}
 	}
 
-	if sm.subscribers[c.Name][broadcasting] == nil {
-		sm.subscribers[c.Name][broadcasting] = map[*Channel]struct{}{}
+	set, ok := shard.subscribers[key]
+
+	if !ok {
+		set = &subscriberSet{channels: map[*Channel]struct{}{}}
+		shard.subscribers[key] = set
 	}
 
-	sm.subscribers[c.Name][broadcasting][c] = struct{}{}
+	if _, ok := set.channels[c]; !ok {
+		set.channels[c] = struct{}{}
+		set.snapshot = nil
+	}
 
 	return
 }
 
 func (sm *SubscriberMap) Broadcast(channelName, broadcasting string, message []byte) (err error) {
-	_, ok := sm.subscribers[channelName]
-
-	if !ok {
-		logger.Error("Can't find any subscribers for Channel " + channelName)
+	return sm.publish(newBroadcastMessage(channelName, broadcasting, message))
+}
 
-		return
-	}
+func (sm *SubscriberMap) publish(msg *broadcastMessage) (err error) {
+	channelName, broadcasting, message := msg.channelName, msg.broadcasting, msg.data
+	subscribers := sm.subscribers(channelName, broadcasting)
 
-	subscribers, ok := sm.subscribers[channelName][broadcasting]
+	if len(subscribers) == 0 {
+		logger.Debug(fmt.Sprintf("No subscribers of %s streaming from %s", channelName, broadcasting))
 
-	if !ok {
 		return
 	}
 
-	logger.Debug(fmt.Sprintf("Broadcasting to %s: %s", broadcasting, message))
+	logger.Debug(fmt.Sprintf("Broadcasting to %d subscribers of %s: %s", len(subscribers), broadcasting, message))
 
 	go func() {
-		for c := range subscribers {
-			logger.Debug(fmt.Sprintf("%s transmitting %s (via streamed from %s)", c.Name, message, broadcasting))
-
-			sm.sending <- &envelope{receiver: c, message: message}
+		for _, c := range subscribers {
+			select {
+			case sm.sending <- &envelope{receiver: c, message: msg}:
+			case <-sm.done:
+				return
+			}
 		}
 	}()
 
@@ -109,26 +137,76 @@ func (sm *SubscriberMap) Broadcast(channelName, broadcasting string, message []b
 }
 
 func (sm *SubscriberMap) Unsubscribe(c *Channel, broadcasting string) (err error) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	key := subscriberKey{channelName: c.Name, broadcasting: broadcasting}
+	shard := sm.shard(broadcasting)
 
-	_, ok := sm.subscribers[c.Name]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	set, ok := shard.subscribers[key]
 
 	if !ok {
 		return
 	}
 
-	if _, ok := sm.subscribers[c.Name][broadcasting]; ok {
-		delete(sm.subscribers[c.Name][broadcasting], c)
+	if _, ok := set.channels[c]; ok {
+		delete(set.channels, c)
+		set.snapshot = nil
+	}
+
+	if len(set.channels) == 0 {
+		delete(shard.subscribers, key)
+	}
 
-		if len(sm.subscribers[c.Name][broadcasting]) == 0 {
-			delete(sm.subscribers[c.Name], broadcasting)
-		}
+	return
+}
+
+// The snapshot of the subscribers of the broadcasting in the channel, which must not be modified.
+func (sm *SubscriberMap) subscribers(channelName, broadcasting string) []*Channel {
+	key := subscriberKey{channelName: channelName, broadcasting: broadcasting}
+	shard := sm.shard(broadcasting)
+
+	shard.mu.RLock()
+	set, ok := shard.subscribers[key]
+	var snapshot []*Channel
+	if ok {
+		snapshot = set.snapshot
+	}
+	shard.mu.RUnlock()
+
+	if !ok || snapshot != nil {
+		return snapshot
+	}
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-		if len(sm.subscribers[c.Name]) == 0 {
-			delete(sm.subscribers, c.Name)
+	// Rebuilt by the other broadcasts meanwhile, or changed again.
+	set, ok = shard.subscribers[key]
+
+	if !ok {
+		return nil
+	}
+
+	if set.snapshot == nil {
+		set.snapshot = make([]*Channel, 0, len(set.channels))
+
+		for c := range set.channels {
+			set.snapshot = append(set.snapshot, c)
 		}
 	}
 
-	return
+	return set.snapshot
+}
+
+func (sm *SubscriberMap) shard(broadcasting string) *subscriberShard {
+	// FNV-1a
+	h := uint32(2166136261)
+
+	for i := 0; i < len(broadcasting); i++ {
+		h ^= uint32(broadcasting[i])
+		h *= 16777619
+	}
+
+	return &sm.shards[h%subscriberShards]
 }
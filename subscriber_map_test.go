@@ -1,6 +1,13 @@
 package actioncable
 
-import "testing"
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestRunAndClose(t *testing.T) {
 	sm := &SubscriberMap{}
@@ -22,3 +29,147 @@ func TestRunAndClose(t *testing.T) {
 		t.Error("done channel is still open.")
 	}
 }
+
+func newTestSubscriber(onBroadcast func(*Channel, *broadcastMessage)) *Channel {
+	if onBroadcast == nil {
+		onBroadcast = func(*Channel, *broadcastMessage) {}
+	}
+
+	return &Channel{Name: "RoomChannel", onBroadcast: onBroadcast}
+}
+
+func TestSubscriberSnapshots(t *testing.T) {
+	sm := &SubscriberMap{}
+	c1, c2 := newTestSubscriber(nil), newTestSubscriber(nil)
+
+	sm.Subscribe(c1, "room_1")
+	sm.Subscribe(c2, "room_1")
+	sm.Subscribe(c1, "room_2")
+
+	snapshot := sm.subscribers("RoomChannel", "room_1")
+
+	if len(snapshot) != 2 || len(sm.subscribers("RoomChannel", "room_2")) != 1 || sm.subscribers("ChatChannel", "room_1") != nil {
+		t.Errorf("Unexpected subscribers: %+v", snapshot)
+	}
+
+	if again := sm.subscribers("RoomChannel", "room_1"); &again[0] != &snapshot[0] {
+		t.Error("The snapshot is rebuilt without changes.")
+	}
+
+	sm.Unsubscribe(c1, "room_1")
+
+	if len(snapshot) != 2 || snapshot[0] == nil || snapshot[1] == nil {
+		t.Errorf("The snapshot is modified: %+v", snapshot)
+	}
+
+	if s := sm.subscribers("RoomChannel", "room_1"); len(s) != 1 || s[0] != c2 {
+		t.Errorf("Unexpected subscribers: %+v", s)
+	}
+
+	sm.Unsubscribe(c2, "room_1")
+
+	if s := sm.subscribers("RoomChannel", "room_1"); s != nil {
+		t.Errorf("Unexpected subscribers: %+v", s)
+	}
+}
+
+// Run it with -race.
+func TestSubscriberMapConcurrency(t *testing.T) {
+	sm := &SubscriberMap{}
+	sm.Run()
+	defer sm.Stop()
+
+	var delivered int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			broadcasting := fmt.Sprintf("room_%d", i%4)
+			c := newTestSubscriber(func(*Channel, *broadcastMessage) { atomic.AddInt64(&delivered, 1) })
+
+			for j := 0; j < 200; j++ {
+				sm.Subscribe(c, broadcasting)
+				sm.Broadcast("RoomChannel", broadcasting, []byte(`"hello"`))
+				sm.Unsubscribe(c, broadcasting)
+			}
+
+			sm.Subscribe(c, broadcasting)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if s := sm.subscribers("RoomChannel", fmt.Sprintf("room_%d", i)); len(s) != 2 {
+			t.Errorf("Unexpected subscribers of room_%d: %+v", i, s)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if n := atomic.LoadInt64(&delivered); n < 8*200 {
+		t.Errorf("Unexpected delivered messages: %d", n)
+	}
+}
+
+// Broadcasting to the subscribers of a broadcasting, until they all received it.
+func BenchmarkSubscriberMapBroadcast(b *testing.B) {
+	sm := &SubscriberMap{}
+	sm.Run()
+	defer sm.Stop()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 1000; i++ {
+		sm.Subscribe(newTestSubscriber(func(*Channel, *broadcastMessage) { wg.Done() }), "room_1")
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		wg.Add(1000)
+		sm.Broadcast("RoomChannel", "room_1", []byte(`"hello"`))
+		wg.Wait()
+	}
+}
+
+// Broadcasting to 1000 broadcastings concurrently, while one in every 4 operations subscribes and unsubscribes.
+func BenchmarkSubscriberMapChurn(b *testing.B) {
+	sm := &SubscriberMap{}
+	sm.Run()
+	defer sm.Stop()
+
+	broadcastings := make([]string, 1000)
+
+	for i := range broadcastings {
+		broadcastings[i] = fmt.Sprintf("room_%d", i)
+
+		for j := 0; j < 10; j++ {
+			sm.Subscribe(newTestSubscriber(nil), broadcastings[i])
+		}
+	}
+
+	var seed int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+		c := newTestSubscriber(nil)
+
+		for i := 0; pb.Next(); i++ {
+			broadcasting := broadcastings[r.Intn(len(broadcastings))]
+
+			if i%4 == 0 {
+				sm.Subscribe(c, broadcasting)
+				sm.Unsubscribe(c, broadcasting)
+			} else {
+				sm.Broadcast("RoomChannel", broadcasting, []byte(`"hello"`))
+			}
+		}
+	})
+}
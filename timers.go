@@ -0,0 +1,113 @@
+package actioncable
+
+import (
+	"fmt"
+	"time"
+)
+
+// A task run every interval while the channel is subscribed, like `periodically :method, every: 5.seconds` of
+// Rails channels. The timers start once the subscription is confirmed (or restored), and stop once it's
+// unsubscribed or the connection is closed. The panics of the callbacks are handed to the rescuer.
+type PeriodicTimer struct {
+	Every    time.Duration
+	Callback func(c *Channel)
+}
+
+// Run the callback every interval while the channel is subscribed, see PeriodicTimer. Could be called in the
+// Subscribed callback, or any time later.
+//
+// NOTE: the subscriptions with such timers are not restored with the sessions, the clients subscribe to them again
+// instead. The timers of ChannelDescription.Periodically are.
+func (c *Channel) Every(interval time.Duration, callback func(c *Channel)) {
+	if interval <= 0 {
+		logger.Error(fmt.Sprintf("%s ignored the periodic timer of invalid interval %v", c.Name, interval))
+
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.everyCalled = true
+	t := PeriodicTimer{Every: interval, Callback: callback}
+
+	if c.timersStarted {
+		c.runTimer(t)
+	} else {
+		c.timers = append(c.timers, t)
+	}
+}
+
+func (c *Channel) startTimers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timersStarted {
+		return
+	}
+
+	c.timersStarted = true
+
+	for _, t := range c.descrption.Periodically {
+		c.runTimer(t)
+	}
+
+	for _, t := range c.timers {
+		c.runTimer(t)
+	}
+
+	c.timers = nil
+}
+
+func (c *Channel) stopTimers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timersStopped = true
+	c.timers = nil
+
+	if c.timersStop != nil {
+		close(c.timersStop)
+		c.timersStop = nil
+	}
+}
+
+// It's called holding c.mu.
+func (c *Channel) runTimer(t PeriodicTimer) {
+	if c.timersStopped {
+		return
+	}
+
+	if c.timersStop == nil {
+		c.timersStop = make(chan struct{})
+	}
+
+	stop := c.timersStop
+
+	go func() {
+		ticker := time.NewTicker(t.Every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.tick(t, stop)
+			}
+		}
+	}()
+}
+
+func (c *Channel) tick(t PeriodicTimer, stop chan struct{}) {
+	defer c.conn.rescuePanic()
+
+	// The ticker and the stop could be ready at once.
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	t.Callback(c)
+}
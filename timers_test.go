@@ -0,0 +1,109 @@
+package actioncable
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeriodicTimers(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+
+	cable.PubSub.Run()
+	defer cable.PubSub.Stop()
+
+	var declared, added int32
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.Every(5*time.Millisecond, func(c *Channel) {
+				atomic.AddInt32(&added, 1)
+			})
+		},
+		Periodically: []PeriodicTimer{
+			{Every: 5 * time.Millisecond, Callback: func(c *Channel) { atomic.AddInt32(&declared, 1) }},
+		},
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	time.Sleep(30 * time.Millisecond)
+
+	if atomic.LoadInt32(&declared) == 0 || atomic.LoadInt32(&added) == 0 {
+		t.Errorf("The timers didn't run: %d, %d", declared, added)
+	}
+
+	ws.write([]byte(`{"command":"unsubscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	stopped := atomic.LoadInt32(&declared) + atomic.LoadInt32(&added)
+	time.Sleep(30 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&declared) + atomic.LoadInt32(&added); n != stopped {
+		t.Errorf("The timers run %d times after unsubscribed.", n-stopped)
+	}
+}
+
+func TestPeriodicTimersOfRejectedSubscription(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+	var ticks int32
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Subscribed: func(c *Channel) {
+			c.Every(time.Millisecond, func(c *Channel) { atomic.AddInt32(&ticks, 1) })
+			c.Reject()
+		},
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+	time.Sleep(10 * time.Millisecond)
+
+	if atomic.LoadInt32(&ticks) != 0 {
+		t.Error("The timer of the rejected subscription runs.")
+	}
+}
+
+func TestPeriodicTimerPanics(t *testing.T) {
+	conn, ws := newTestConnection("user1")
+	cable := conn.cable
+	rescued := make(chan any, 1)
+
+	cable.Config.WithRescuer(func(c *Connection, e any) {
+		rescued <- e
+		c.Close("rescued")
+	})
+
+	cable.RegisterChannel(&ChannelDescription{
+		Name: "RoomChannel",
+		Periodically: []PeriodicTimer{
+			{Every: time.Millisecond, Callback: func(c *Channel) { panic("oops") }},
+		},
+	})
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\"}"}`))
+
+	select {
+	case e := <-rescued:
+		if e != "oops" {
+			t.Errorf("Unexpected panic: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The panic is not rescued.")
+	}
+
+	select {
+	case e := <-rescued:
+		t.Errorf("The timer runs after the connection is closed: %v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,142 @@
+package actioncable
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The channel `turbo_stream_from` subscribes to.
+const TurboStreamsChannelName = "Turbo::StreamsChannel"
+
+// Returned when a signed stream name is tampered, malformed or expired.
+var ErrInvalidSignature = errors.New("actioncable: invalid signature")
+
+// A channel compatible with Turbo::StreamsChannel of turbo-rails. The subscriptions declare the stream by the
+// `signed_stream_name` param, which is verified with the secret before streaming from it. The tampered ones are
+// rejected.
+//
+// The secret is the key of `Turbo.signed_stream_verifier`, i.e. by default
+// `Rails.application.key_generator.generate_key("turbo/signed_stream_verifier_key")`.
+func NewTurboStreamsChannel(secret []byte) *ChannelDescription {
+	return &ChannelDescription{
+		Name: TurboStreamsChannelName,
+		Subscribed: func(c *Channel) {
+			params := struct {
+				SignedStreamName string `json:"signed_stream_name"`
+			}{}
+
+			json.Unmarshal(c.Params, &params)
+
+			name, err := VerifyTurboStreamName(secret, params.SignedStreamName)
+
+			if err != nil {
+				logger.Info(fmt.Sprintf("Rejected a Turbo stream subscription: %v", err))
+				c.Reject()
+
+				return
+			}
+
+			c.StreamFrom(name)
+		},
+	}
+}
+
+// Broadcast the rendered turbo stream actions (e.g. `<turbo-stream action="append" ...>`) to the subscribers
+// of the stream.
+func (cb *Cable) BroadcastTurboStream(streamName, html string) error {
+	return cb.Broadcast(TurboStreamsChannelName, streamName, html)
+}
+
+// Sign a stream name the way `Turbo::StreamsChannel.signed_stream_name` does.
+func SignTurboStreamName(secret []byte, streamName string) string {
+	b, _ := json.Marshal(streamName)
+	data := base64.StdEncoding.EncodeToString(b)
+
+	return data + "--" + turboDigest(secret, data)
+}
+
+// Verify a stream name signed by `Turbo::StreamsChannel.signed_stream_name` (the ActiveSupport::MessageVerifier
+// format, with the JSON serializer and SHA256 digest) and return the stream name.
+func VerifyTurboStreamName(secret []byte, signed string) (string, error) {
+	i := strings.LastIndex(signed, "--")
+
+	if i < 0 {
+		return "", fmt.Errorf("%w: malformed message", ErrInvalidSignature)
+	}
+
+	data, digest := signed[:i], signed[i+2:]
+
+	if !hmac.Equal([]byte(digest), []byte(turboDigest(secret, data))) {
+		return "", ErrInvalidSignature
+	}
+
+	b, err := base64.StdEncoding.DecodeString(data)
+
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	return decodeTurboStreamName(b)
+}
+
+func turboDigest(secret []byte, data string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// The signed message is either the stream name itself, or wrapped in the `_rails` envelope carrying the
+// expiration (`data` since Rails 7.1, base64 encoded `message` before).
+func decodeTurboStreamName(b []byte) (string, error) {
+	var name string
+
+	if err := json.Unmarshal(b, &name); err == nil {
+		return name, nil
+	}
+
+	envelope := struct {
+		Rails *struct {
+			Data    json.RawMessage `json:"data"`
+			Message string          `json:"message"`
+			Exp     string          `json:"exp"`
+		} `json:"_rails"`
+	}{}
+
+	if err := json.Unmarshal(b, &envelope); err != nil || envelope.Rails == nil {
+		return "", fmt.Errorf("%w: malformed message", ErrInvalidSignature)
+	}
+
+	rails := envelope.Rails
+
+	if rails.Exp != "" {
+		exp, err := time.Parse(time.RFC3339Nano, rails.Exp)
+
+		if err != nil || time.Now().After(exp) {
+			return "", fmt.Errorf("%w: expired", ErrInvalidSignature)
+		}
+	}
+
+	data := []byte(rails.Data)
+
+	if rails.Message != "" {
+		var err error
+
+		if data, err = base64.StdEncoding.DecodeString(rails.Message); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &name); err != nil {
+		return "", fmt.Errorf("%w: malformed message", ErrInvalidSignature)
+	}
+
+	return name, nil
+}
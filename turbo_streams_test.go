@@ -0,0 +1,94 @@
+package actioncable
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyTurboStreamName(t *testing.T) {
+	secret := []byte("secret")
+	signed := "ImdpZDovL2FwcC9Sb29tLzE6bWVzc2FnZXMi--9150bbc9e7a24c8d04eb34c3cc2e4326b5645d34f2ca5375987cc246e2b56b5e"
+
+	if name, err := VerifyTurboStreamName(secret, signed); err != nil || name != "gid://app/Room/1:messages" {
+		t.Errorf("Unexpected stream name: %s, %v", name, err)
+	}
+
+	if SignTurboStreamName(secret, "gid://app/Room/1:messages") != signed {
+		t.Error("Unexpected signed stream name.")
+	}
+
+	for _, s := range []string{
+		"",
+		"ImdpZDovL2FwcC9Sb29tLzE6bWVzc2FnZXMi",
+		"ImdpZDovL2FwcC9Sb29tLzI6bWVzc2FnZXMi--9150bbc9e7a24c8d04eb34c3cc2e4326b5645d34f2ca5375987cc246e2b56b5e",
+		SignTurboStreamName([]byte("another secret"), "gid://app/Room/1:messages"),
+	} {
+		if _, err := VerifyTurboStreamName(secret, s); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%q is not rejected: %v", s, err)
+		}
+	}
+}
+
+func TestVerifyTurboStreamNameEnvelope(t *testing.T) {
+	secret := []byte("secret")
+	sign := func(message string) string {
+		data := base64.StdEncoding.EncodeToString([]byte(message))
+
+		return data + "--" + turboDigest(secret, data)
+	}
+
+	exp := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	legacy := base64.StdEncoding.EncodeToString([]byte(`"room_1"`))
+
+	for _, message := range []string{
+		`{"_rails":{"data":"room_1","exp":null,"pur":null}}`,
+		fmt.Sprintf(`{"_rails":{"data":"room_1","exp":%q,"pur":null}}`, exp),
+		fmt.Sprintf(`{"_rails":{"message":%q,"exp":null,"pur":null}}`, legacy),
+	} {
+		if name, err := VerifyTurboStreamName(secret, sign(message)); err != nil || name != "room_1" {
+			t.Errorf("Unexpected stream name of %s: %s, %v", message, name, err)
+		}
+	}
+
+	expired := `{"_rails":{"data":"room_1","exp":"2000-01-01T00:00:00.000Z","pur":null}}`
+
+	if _, err := VerifyTurboStreamName(secret, sign(expired)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("The expired stream name is not rejected: %v", err)
+	}
+}
+
+func TestTurboStreamsChannel(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	cable := conn.cable
+	secret := []byte("secret")
+
+	cable.RegisterChannel(NewTurboStreamsChannel(secret))
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	identifier := fmt.Sprintf(`{"channel":"Turbo::StreamsChannel","signed_stream_name":%q}`, SignTurboStreamName(secret, "room_1"))
+	ws.write([]byte(fmt.Sprintf(`{"command":"subscribe","identifier":%q}`, identifier)))
+
+	m, _ := ws.lastMessage().(map[string]string)
+
+	if m["type"] != "confirm_subscription" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+
+	if cable.PubSub.(*SubscriberMap).subscribers(TurboStreamsChannelName, "room_1") == nil {
+		t.Error("Didn't stream from room_1")
+	}
+
+	tampered := fmt.Sprintf(`{"channel":"Turbo::StreamsChannel","signed_stream_name":%q}`, "InJvb21fMiI=--0000")
+	ws.write([]byte(fmt.Sprintf(`{"command":"subscribe","identifier":%q}`, tampered)))
+
+	m, _ = ws.lastMessage().(map[string]string)
+
+	if m["type"] != "reject_subscription" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
@@ -0,0 +1,130 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// A subscription of a typed channel, with the params decoded into P and the state S of the subscription.
+// NOTE: Params shadows the raw Channel.Params, which is still available as Subscription.Channel.Params.
+type Subscription[P, S any] struct {
+	*Channel
+	Params P
+	State  S
+}
+
+// Handle a client action of a typed channel, the data is the payload of the action without the `action` key.
+type TypedActionCallback[P, S any] func(s *Subscription[P, S], data json.RawMessage)
+
+// A channel whose subscription params are decoded into P once at subscribe time, the subscriptions with malformed
+// params are rejected. The state S is kept per subscription and shared by all the callbacks.
+type TypedChannelDescription[P, S any] struct {
+	Name          string
+	Subscribed    func(s *Subscription[P, S])
+	Unsubscribed  func(s *Subscription[P, S])
+	Actions       map[string]TypedActionCallback[P, S]
+	UnknownAction func(s *Subscription[P, S], action string, data json.RawMessage)
+}
+
+// Build the ChannelDescription of a typed channel, to be registered by Cable.RegisterChannel.
+//
+// E.g.
+//
+//	type RoomParams struct {
+//	  ID int `json:"id"`
+//	}
+//
+//	type RoomState struct {
+//	  Messages int
+//	}
+//
+//	cable.RegisterChannel(actioncable.NewTypedChannel(&actioncable.TypedChannelDescription[RoomParams, RoomState]{
+//	  Name: "RoomChannel",
+//	  Subscribed: func(s *actioncable.Subscription[RoomParams, RoomState]) {
+//	    s.StreamFrom(fmt.Sprintf("room_%d", s.Params.ID))
+//	  },
+//	}))
+func NewTypedChannel[P, S any](d *TypedChannelDescription[P, S]) *ChannelDescription {
+	cd := &ChannelDescription{
+		Name: d.Name,
+		Subscribed: func(c *Channel) {
+			s := &Subscription[P, S]{Channel: c}
+
+			if err := json.Unmarshal(c.Params, &s.Params); err != nil {
+				logger.Info(fmt.Sprintf("Rejected the subscription to %s with malformed params %s: %v", c.Name, c.Params, err))
+				c.Reject()
+
+				return
+			}
+
+			c.mu.Lock()
+			c.state = s
+			c.mu.Unlock()
+
+			if d.Subscribed != nil {
+				d.Subscribed(s)
+			}
+		},
+		Unsubscribed: func(c *Channel) {
+			if s := typedSubscription[P, S](c); s != nil && d.Unsubscribed != nil {
+				d.Unsubscribed(s)
+			}
+		},
+		Actions: map[string]ChannelActionCallback{},
+	}
+
+	for action, handler := range d.Actions {
+		handler := handler
+		cd.Actions[action] = func(c *Channel, data json.RawMessage) {
+			if s := typedSubscription[P, S](c); s != nil {
+				handler(s, data)
+			}
+		}
+	}
+
+	if d.UnknownAction != nil {
+		cd.UnknownAction = func(c *Channel, action string, data json.RawMessage) {
+			if s := typedSubscription[P, S](c); s != nil {
+				d.UnknownAction(s, action, data)
+			}
+		}
+	}
+
+	return cd
+}
+
+// Decode the payload of the action into D for the handler. The actions with malformed payloads are dropped.
+func TypedAction[P, S, D any](handler func(s *Subscription[P, S], data D)) TypedActionCallback[P, S] {
+	return func(s *Subscription[P, S], raw json.RawMessage) {
+		var data D
+
+		if err := json.Unmarshal(raw, &data); err != nil {
+			logger.Error(fmt.Sprintf("Unable to process %s: malformed data %s", s.Name, raw))
+
+			return
+		}
+
+		handler(s, data)
+	}
+}
+
+// The typed subscription of the channel. The subscriptions restored without the Subscribed callback get the
+// params decoded again and the state starts over.
+func typedSubscription[P, S any](c *Channel) *Subscription[P, S] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.state.(*Subscription[P, S]); ok {
+		return s
+	}
+
+	s := &Subscription[P, S]{Channel: c}
+
+	if err := json.Unmarshal(c.Params, &s.Params); err != nil {
+		return nil
+	}
+
+	c.state = s
+
+	return s
+}
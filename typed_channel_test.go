@@ -0,0 +1,74 @@
+package actioncable
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+type testRoomParams struct {
+	ID int `json:"id"`
+}
+
+type testRoomState struct {
+	Messages []string
+}
+
+type testSpeakData struct {
+	Message string `json:"message"`
+}
+
+func TestTypedChannel(t *testing.T) {
+	conn, ws := newTestConnection("test")
+	cable := conn.cable
+	unsubscribed := []*testRoomState{}
+
+	cable.RegisterChannel(NewTypedChannel(&TypedChannelDescription[testRoomParams, testRoomState]{
+		Name: "RoomChannel",
+		Subscribed: func(s *Subscription[testRoomParams, testRoomState]) {
+			s.StreamFrom(fmt.Sprintf("room_%d", s.Params.ID))
+		},
+		Unsubscribed: func(s *Subscription[testRoomParams, testRoomState]) {
+			unsubscribed = append(unsubscribed, &s.State)
+		},
+		Actions: map[string]TypedActionCallback[testRoomParams, testRoomState]{
+			"speak": TypedAction(func(s *Subscription[testRoomParams, testRoomState], data testSpeakData) {
+				s.State.Messages = append(s.State.Messages, fmt.Sprintf("room_%d: %s", s.Params.ID, data.Message))
+			}),
+		},
+	}))
+
+	conn.Setup()
+	defer conn.Close("test complete")
+
+	ws.write([]byte(`{"command":"subscribe", "identifier":"{\"channel\":\"RoomChannel\",\"id\":\"one\"}"}`))
+
+	if m, _ := ws.lastMessage().(map[string]string); m["type"] != "reject_subscription" {
+		t.Errorf("The subscription with malformed params is not rejected: %+v", m)
+	}
+
+	identifier := `{\"channel\":\"RoomChannel\",\"id\":1}`
+	ws.write([]byte(`{"command":"subscribe", "identifier":"` + identifier + `"}`))
+
+	if m, _ := ws.lastMessage().(map[string]string); m["type"] != "confirm_subscription" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+
+	for _, data := range []string{
+		`{\"action\":\"speak\",\"message\":\"hello\"}`,
+		`{\"action\":\"speak\",\"message\":1}`,
+		`{\"action\":\"speak\",\"message\":\"bye\"}`,
+	} {
+		ws.write([]byte(`{"command":"message", "identifier":"` + identifier + `", "data":"` + data + `"}`))
+	}
+
+	ws.write([]byte(`{"command":"unsubscribe", "identifier":"` + identifier + `"}`))
+
+	if len(unsubscribed) != 1 {
+		t.Fatalf("Unexpected unsubscriptions: %d", len(unsubscribed))
+	}
+
+	if b, _ := json.Marshal(unsubscribed[0].Messages); string(b) != `["room_1: hello","room_1: bye"]` {
+		t.Errorf("Unexpected state: %s", b)
+	}
+}